@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/triiberg/smartpasta/pkg/smartpasta"
+)
+
+// Exit codes, for shell scripts.
+const (
+	exitOK          = 0
+	exitFailed      = 1 // the daemon rejected the request, or nothing matched
+	exitUsage       = 2
+	exitUnavailable = 3 // the daemon could not be reached
+)
+
+const previewRunes = 80
+
+var errUsage = errors.New("usage")
+
+// errNoMatch makes a command exit with exitFailed without printing an error.
+var errNoMatch = errors.New("no match")
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, c *smartpasta.Client, args []string) error
+}
+
+var commands = map[string]command{
+	"list":    {"list [-json] [-limit n]", runList},
+	"get":     {"get [-json] <id>", runGet},
+	"copy":    {"copy [-clipboard=false] [-pin] [-sensitive]  (reads stdin)", runCopy},
+	"select":  {"select <id>", runSelect},
+	"delete":  {"delete <id>", runDelete},
+	"clear":   {"clear", runClear},
+	"dump":    {"dump [-format file|text|json]", runDump},
+	"search":  {"search [-json] [-mode substring|icase|fuzzy|regex] [-limit n] <query>", runSearch},
+	"watch":   {"watch [-json]", runWatch},
+	"boards":  {"boards [-json]", runBoards},
+	"board":   {"board create|switch|delete <name> | board move <id> <to>", runBoard},
+	"version": {"version [-json]", runVersion},
+}
+
+var commandOrder = []string{"list", "get", "copy", "select", "delete", "clear", "dump", "search", "watch", "boards", "board", "version"}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("smartpasta-ctl", flag.ContinueOnError)
+	socket := flags.String("socket", "", "daemon socket (default ~/.cache/smartpasta/smartpasta.sock)")
+	board := flags.String("board", "", "board to act on (default: the active board)")
+	flags.Usage = func() { usage(flags) }
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		usage(flags)
+		return exitUsage
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "smartpasta-ctl: unknown command %q\n", flags.Arg(0))
+		usage(flags)
+		return exitUsage
+	}
+
+	ctx := context.Background()
+	c, err := smartpasta.Dial(ctx, *socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "smartpasta-ctl: %v\n", err)
+		return exitUnavailable
+	}
+	defer c.Close()
+	c.Board = *board
+
+	switch err := cmd.run(ctx, c, flags.Args()[1:]); {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(os.Stderr, "usage: smartpasta-ctl %s\n", cmd.usage)
+		return exitUsage
+	case errors.Is(err, errNoMatch):
+		return exitFailed
+	default:
+		fmt.Fprintf(os.Stderr, "smartpasta-ctl: %v\n", err)
+		return exitFailed
+	}
+}
+
+func usage(flags *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "usage: smartpasta-ctl [-socket path] [-board name] <command> [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range commandOrder {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\noptions:")
+	flags.PrintDefaults()
+}
+
+// parseFlags parses a command's flags and checks its positional argument
+// count.
+func parseFlags(flags *flag.FlagSet, args []string, positional int) error {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil || flags.NArg() != positional {
+		return errUsage
+	}
+	return nil
+}
+
+func parseID(arg string) (int64, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errUsage
+	}
+	return id, nil
+}
+
+func runList(ctx context.Context, c *smartpasta.Client, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "")
+	limit := flags.Int("limit", 0, "")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	entries, err := c.History(ctx)
+	if err != nil {
+		return err
+	}
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[:*limit]
+	}
+	if *asJSON {
+		return printJSON(entries)
+	}
+	for _, entry := range entries {
+		printEntryLine(entry)
+	}
+	return nil
+}
+
+func runGet(ctx context.Context, c *smartpasta.Client, args []string) error {
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	id, err := parseID(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	entry, err := c.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(entry)
+	}
+	_, err = io.WriteString(os.Stdout, entry.Content)
+	return err
+}
+
+func runCopy(ctx context.Context, c *smartpasta.Client, args []string) error {
+	flags := flag.NewFlagSet("copy", flag.ContinueOnError)
+	opts := smartpasta.AddOptions{Source: "smartpasta-ctl"}
+	flags.BoolVar(&opts.Clipboard, "clipboard", true, "")
+	flags.BoolVar(&opts.Pinned, "pin", false, "")
+	flags.BoolVar(&opts.Sensitive, "sensitive", false, "")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	content, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	entry, err := c.Add(ctx, string(content), opts)
+	if err != nil {
+		return err
+	}
+	fmt.Println(entry.ID)
+	return nil
+}
+
+func runSelect(ctx context.Context, c *smartpasta.Client, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	id, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	return c.Select(ctx, id)
+}
+
+func runDelete(ctx context.Context, c *smartpasta.Client, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	id, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	return c.Delete(ctx, id)
+}
+
+func runClear(ctx context.Context, c *smartpasta.Client, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return c.Clear(ctx)
+}
+
+// runDump has the daemon write its dump file, or with -format text|json
+// prints the board oldest first to stdout.
+func runDump(ctx context.Context, c *smartpasta.Client, args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	format := flags.String("format", "file", "")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	if *format == "file" {
+		return c.Dump(ctx)
+	}
+	entries, err := c.History(ctx)
+	if err != nil {
+		return err
+	}
+	// Like dump files, printed dumps leave sensitive entries out; they are
+	// listed oldest first.
+	records := make([]smartpasta.Entry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Sensitive {
+			records = append(records, entries[i])
+		}
+	}
+	switch *format {
+	case "json":
+		return printJSON(records)
+	case "text":
+		for i, entry := range records {
+			if i > 0 {
+				fmt.Print("\n-----\n")
+			}
+			fmt.Print(entry.Content)
+		}
+		fmt.Println()
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+func runSearch(ctx context.Context, c *smartpasta.Client, args []string) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "")
+	mode := flags.String("mode", smartpasta.SearchFuzzy, "")
+	limit := flags.Int("limit", 0, "")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	matches, _, err := c.Search(ctx, smartpasta.Query{Text: flags.Arg(0), Mode: *mode, Limit: *limit})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if err := printJSON(matches); err != nil {
+			return err
+		}
+	} else {
+		for _, match := range matches {
+			printEntryLine(match.Entry)
+		}
+	}
+	if len(matches) == 0 {
+		return errNoMatch
+	}
+	return nil
+}
+
+// runWatch prints history changes as they happen until the daemon goes
+// away.
+func runWatch(ctx context.Context, c *smartpasta.Client, args []string) error {
+	flags := flag.NewFlagSet("watch", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	sub, err := c.Subscribe(ctx, c.Board)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+	for {
+		change, err := sub.Next(ctx)
+		if err != nil {
+			return errors.New("connection closed")
+		}
+		if *asJSON {
+			if err := printJSON(change); err != nil {
+				return err
+			}
+			continue
+		}
+		switch {
+		case change.Entry != nil && change.Entry.Sensitive:
+			fmt.Printf("%s\t%s\t%d\t********\n", change.Type, change.Board, change.Entry.ID)
+		case change.Entry != nil:
+			fmt.Printf("%s\t%s\t%d\t%s\n", change.Type, change.Board, change.Entry.ID, preview(change.Entry.Content))
+		case change.ID != 0:
+			fmt.Printf("%s\t%s\t%d\n", change.Type, change.Board, change.ID)
+		default:
+			fmt.Printf("%s\t%s\n", change.Type, change.Board)
+		}
+	}
+}
+
+// runBoards lists the boards; the active one is marked with "*".
+func runBoards(ctx context.Context, c *smartpasta.Client, args []string) error {
+	flags := flag.NewFlagSet("boards", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	boards, err := c.Boards(ctx)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(boards)
+	}
+	for _, board := range boards {
+		active := ""
+		if board.Active {
+			active = "*"
+		}
+		fmt.Printf("%s%s\t%d\n", board.Name, active, board.Entries)
+	}
+	return nil
+}
+
+// runBoard manages boards. move takes the entry from the -board board, or
+// the active one, to another board.
+func runBoard(ctx context.Context, c *smartpasta.Client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch action, args := args[0], args[1:]; {
+	case action == "move" && len(args) == 2:
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+		_, err = c.Move(ctx, id, args[1])
+		return err
+	case len(args) != 1:
+		return errUsage
+	case action == "create":
+		return c.CreateBoard(ctx, args[0])
+	case action == "switch":
+		return c.SwitchBoard(ctx, args[0])
+	case action == "delete":
+		return c.DeleteBoard(ctx, args[0])
+	default:
+		return errUsage
+	}
+}
+
+// runVersion prints what the daemon reports about itself.
+func runVersion(ctx context.Context, c *smartpasta.Client, args []string) error {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	hello, err := c.Hello(ctx)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(hello)
+	}
+	if hello.Protocol == 0 {
+		fmt.Println("daemon predates protocol versioning")
+		return nil
+	}
+	fmt.Printf("daemon %s (%s), protocol %d\n", hello.Version, hello.Flavor, hello.Protocol)
+	fmt.Printf("ops: %s\n", strings.Join(hello.Ops, " "))
+	fmt.Printf("capabilities: %s\n", strings.Join(hello.Capabilities, " "))
+	return nil
+}
+
+func printEntryLine(entry smartpasta.Entry) {
+	pin := ""
+	if entry.Pinned {
+		pin = "*"
+	}
+	kind := entry.Kind
+	if kind == "" {
+		kind = "text"
+	}
+	text := preview(entry.Content)
+	if entry.Sensitive {
+		kind, text = "secret", "********"
+	}
+	fmt.Printf("%d%s\t%s\t%s\n", entry.ID, pin, kind, text)
+}
+
+func preview(content string) string {
+	line := strings.Join(strings.Fields(content), " ")
+	if utf8.RuneCountInString(line) > previewRunes {
+		line = string([]rune(line)[:previewRunes-3]) + "..."
+	}
+	return line
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	return encoder.Encode(v)
+}
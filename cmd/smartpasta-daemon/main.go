@@ -10,18 +10,25 @@ import (
 	"syscall"
 	"time"
 
-	"smartpasta/internal/clipboard"
-	"smartpasta/internal/history"
-	"smartpasta/internal/ipc"
-	"smartpasta/internal/logging"
+	"github.com/triiberg/smartpasta/internal/clipboard"
+	"github.com/triiberg/smartpasta/internal/config"
+	"github.com/triiberg/smartpasta/internal/history"
+	"github.com/triiberg/smartpasta/internal/ipc"
+	"github.com/triiberg/smartpasta/internal/logging"
+	"github.com/triiberg/smartpasta/internal/snippet"
 )
 
-var buildFlavor = "stable"
+// Set at build time with -ldflags "-X main.version=...".
+var (
+	version     = "dev"
+	buildFlavor = "stable"
+)
 
 func main() {
 	maxEntries := flag.Int("max-entries", history.DefaultMaxEntries, "maximum clipboard entries")
 	maxBytes := flag.Int("max-bytes", history.DefaultMaxBytes, "maximum clipboard entry size in bytes")
 	display := flag.String("display", "", "X11 display to use (overrides DISPLAY)")
+	snippetsDir := flag.String("snippets", "", "snippet directory (default ~/.config/smartpasta/snippets)")
 	flag.Parse()
 
 	homeDir, err := os.UserHomeDir()
@@ -37,13 +44,35 @@ func main() {
 	cacheDir = filepath.Join(cacheDir, "smartpasta")
 	dumpDir := filepath.Join(homeDir, "smartpasta")
 
+	configDir, err := config.Dir()
+	if err != nil {
+		configDir = filepath.Join(homeDir, ".config", "smartpasta")
+	}
+	if *snippetsDir == "" {
+		*snippetsDir = filepath.Join(configDir, "snippets")
+	}
+	// The daemon only uses the [access] section, and unlike the UI it does
+	// not fall back to defaults when that section is broken, which would
+	// silently drop the access rules.
+	access, err := config.LoadAccess(filepath.Join(configDir, "smartpasta.conf"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	policy, err := ipc.NewPolicy(access.Rules)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[access] %v\n", err)
+		os.Exit(1)
+	}
+
 	logger, err := logging.NewLogger(cacheDir)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "failed to initialize logger")
 		os.Exit(1)
 	}
 
-	historyStore := history.New(*maxEntries, *maxBytes)
+	boards := history.NewBoards(*maxEntries, *maxBytes)
+	snippets := snippet.NewLibrary(*snippetsDir)
 
 	clipboardManager, err := clipboard.NewManager(*maxBytes, *display, logger.Errorf)
 	if err != nil {
@@ -66,24 +95,26 @@ func main() {
 
 	_ = clipboardManager.SetClipboard("smartpasta test")
 
-	onNew := func(content string) {
-		entry, added := historyStore.Add(content)
-		if !added {
+	onNew := func(content string, source string) {
+		board, entry, err := boards.Capture(content, history.AddOptions{Source: source})
+		if err != nil {
 			return
 		}
-		logger.Infof("captured clipboard entry %d", entry.ID)
+		logger.Infof("captured clipboard entry %d board=%s", entry.ID, board)
 		if err := clipboardManager.SetClipboard(content); err != nil {
 			logger.Errorf("failed to set clipboard owner: %v", err)
 		}
 	}
 
-	server, err := ipc.NewServer(filepath.Join(cacheDir, "smartpasta.sock"), dumpDir, historyStore, clipboardManager.SetClipboard, logger.Errorf)
+	server, err := ipc.NewServer(filepath.Join(cacheDir, "smartpasta.sock"), dumpDir, boards, snippets, clipboardManager.SetClipboard, logger.Errorf)
 	if err != nil {
 		logger.Errorf("ipc server error: %v", err)
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 	defer server.Close()
+	server.SetVersion(version, buildFlavor)
+	server.SetPolicy(policy, logger.Infof)
 
 	errCh := make(chan error, 2)
 
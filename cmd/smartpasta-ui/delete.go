@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/triiberg/smartpasta/internal/history"
+	"github.com/triiberg/smartpasta/pkg/smartpasta"
+)
+
+const (
+	keysymDelete xproto.Keysym = 0xffff
+	keysymP      xproto.Keysym = 0x0050
+	keysymp      xproto.Keysym = 0x0070
+	keysymY      xproto.Keysym = 0x0059
+	keysymy      xproto.Keysym = 0x0079
+	keysymZ      xproto.Keysym = 0x005a
+	keysymz      xproto.Keysym = 0x007a
+)
+
+// deletedEntry is an entry removed in this session, remembered with its
+// position so it can be restored.
+type deletedEntry struct {
+	entry    history.Entry
+	position int
+}
+
+// handleEditKey handles Delete (remove highlighted), Shift+Delete (clear
+// all after confirmation), Ctrl+Z (undo a delete) and Ctrl+P (toggle pin).
+// Deletes are only sent to the daemon when the picker closes, which is what
+// makes them undoable.
+func (u *ui) handleEditKey(keymap *keymap, ev xproto.KeyPressEvent, daemon *smartpasta.Client) bool {
+	ctrl := ev.State&xproto.ModMaskControl != 0
+	switch {
+	case keymap.matches(ev.Detail, keysymDelete) && ev.State&xproto.ModMaskShift != 0:
+		u.confirmClear = true
+	case keymap.matches(ev.Detail, keysymDelete):
+		if u.selectionEnabled {
+			u.deleteSelected()
+		}
+	case ctrl && keymap.matches(ev.Detail, keysymZ, keysymz):
+		u.undoDelete()
+	case ctrl && keymap.matches(ev.Detail, keysymP, keysymp):
+		if u.selectionEnabled {
+			u.togglePin(daemon)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// handleConfirmKey answers the clear-all prompt: y clears, any other key
+// cancels.
+func (u *ui) handleConfirmKey(keymap *keymap, ev xproto.KeyPressEvent, daemon *smartpasta.Client) {
+	u.confirmClear = false
+	if !keymap.matches(ev.Detail, keysymY, keysymy) {
+		return
+	}
+	u.flushDeletes(daemon)
+	if err := daemon.Clear(context.Background()); err != nil {
+		return
+	}
+	if entries, err := daemon.History(context.Background()); err == nil {
+		u.setEntries(entries)
+	}
+}
+
+func (u *ui) deleteSelected() {
+	entry := u.state.entries[u.state.selectedIndex]
+	for i, e := range u.state.allEntries {
+		if e.ID != entry.ID {
+			continue
+		}
+		u.deleted = append(u.deleted, deletedEntry{entry: entry, position: i})
+		entries := append(append([]history.Entry{}, u.state.allEntries[:i]...), u.state.allEntries[i+1:]...)
+		u.replaceEntries(entries, u.state.selectedIndex)
+		return
+	}
+}
+
+func (u *ui) undoDelete() {
+	if len(u.deleted) == 0 {
+		return
+	}
+	last := u.deleted[len(u.deleted)-1]
+	u.deleted = u.deleted[:len(u.deleted)-1]
+
+	position := last.position
+	if position > len(u.state.allEntries) {
+		position = len(u.state.allEntries)
+	}
+	entries := append(append([]history.Entry{}, u.state.allEntries[:position]...), last.entry)
+	entries = append(entries, u.state.allEntries[position:]...)
+	u.replaceEntries(entries, 0)
+	for i, e := range u.state.entries {
+		if e.ID == last.entry.ID {
+			u.state.selectedIndex = i
+		}
+	}
+	u.moveSelection(0)
+}
+
+func (u *ui) togglePin(daemon *smartpasta.Client) {
+	entry := u.state.entries[u.state.selectedIndex]
+	updated, err := daemon.SetPinned(context.Background(), entry.ID, !entry.Pinned)
+	if err != nil {
+		return
+	}
+	entries := append([]history.Entry{}, u.state.allEntries...)
+	for i := range entries {
+		if entries[i].ID == updated.ID {
+			entries[i] = updated
+		}
+	}
+	u.replaceEntries(entries, u.state.selectedIndex)
+}
+
+// replaceEntries swaps in a new entry list, keeping the highlight at index
+// (clamped) and the scroll position where possible.
+func (u *ui) replaceEntries(entries []history.Entry, index int) {
+	top := u.state.visibleTop
+	u.setEntries(entries)
+	if index >= len(u.state.entries) {
+		index = len(u.state.entries) - 1
+	}
+	if index < 0 {
+		index = 0
+	}
+	u.state.selectedIndex = index
+	u.state.visibleTop = top
+	u.moveSelection(0)
+}
+
+// flushDeletes sends the deletes made in this session to the daemon.
+func (u *ui) flushDeletes(daemon *smartpasta.Client) {
+	for _, d := range u.deleted {
+		_ = daemon.Delete(context.Background(), d.entry.ID)
+	}
+	u.deleted = nil
+}
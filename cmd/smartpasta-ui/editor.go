@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultTerminal = "x-terminal-emulator"
+
+const (
+	// editorStartTimeout is how long to wait for the editor to start after
+	// the terminal command returned.
+	editorStartTimeout = 15 * time.Second
+	editorPoll         = 200 * time.Millisecond
+)
+
+// waitFlags keep terminals that hand their windows to a running instance
+// in the foreground until the command exits.
+var waitFlags = map[string][]string{
+	"xfce4-terminal": {"--disable-server"},
+	"gnome-terminal": {"--wait"},
+}
+
+// editorScript runs the editor between two marker files, so the end of the
+// edit is known even when the terminal returns at once. The started marker
+// holds the shell's PID; done is also written when the terminal window is
+// closed and the shell gets SIGHUP.
+const editorScript = `started=$1 done=$2; shift 2; trap ': > "$done"' EXIT; trap 'exit 1' HUP INT TERM; echo $$ > "$started"; "$@"`
+
+// editInTerminal writes content to a private temp file, opens it with
+// $VISUAL/$EDITOR inside a terminal and returns the edited text once the
+// editor exits.
+func editInTerminal(content string) (string, bool, error) {
+	editor := strings.Fields(firstEnv("VISUAL", "EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	terminal := strings.Fields(firstEnv("TERMINAL"))
+	if len(terminal) == 0 {
+		terminal = []string{defaultTerminal}
+	}
+
+	dir, err := os.MkdirTemp("", "smartpasta-edit-")
+	if err != nil {
+		return "", false, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "entry.txt")
+	started := filepath.Join(dir, "started")
+	done := filepath.Join(dir, "done")
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		return "", false, fmt.Errorf("write temp file: %w", err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		return "", false, fmt.Errorf("write temp file: %w", err)
+	}
+
+	args := append(append([]string{}, terminal[1:]...), waitFlags[terminalName(terminal[0])]...)
+	args = append(args, "-e", "sh", "-c", editorScript, "sh", started, done)
+	args = append(append(args, editor...), path)
+	cmd := exec.Command(terminal[0], args...)
+	if err := cmd.Run(); err != nil {
+		return "", false, fmt.Errorf("run editor: %w", err)
+	}
+	if err := waitForEditor(started, done); err != nil {
+		return "", false, err
+	}
+
+	after, err := os.Stat(path)
+	if err != nil {
+		return "", false, fmt.Errorf("read temp file: %w", err)
+	}
+	if after.ModTime().Equal(before.ModTime()) && after.Size() == before.Size() {
+		return content, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("read temp file: %w", err)
+	}
+	edited := string(data)
+	// Most editors append a final newline on save; drop it unless the
+	// original content had one.
+	if !strings.HasSuffix(content, "\n") {
+		edited = strings.TrimSuffix(edited, "\n")
+	}
+	if edited == "" {
+		return "", false, errors.New("edited entry is empty")
+	}
+	return edited, edited != content, nil
+}
+
+// waitForEditor waits for the editor script to finish, or for its shell to
+// go away without saying so. The terminal may already have returned while
+// the editor is still open in another process.
+func waitForEditor(started, done string) error {
+	deadline := time.Now().Add(editorStartTimeout)
+	for !exists(done) {
+		data, _ := os.ReadFile(started)
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		switch {
+		case pid > 0 && syscall.Kill(pid, 0) != nil:
+			return nil
+		case pid <= 0 && time.Now().After(deadline):
+			return errors.New("editor did not start")
+		}
+		time.Sleep(editorPoll)
+	}
+	return nil
+}
+
+// terminalName returns the terminal a command runs, following the
+// x-terminal-emulator alternatives link and Debian's .wrapper scripts.
+func terminalName(command string) string {
+	if path, err := exec.LookPath(command); err == nil {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			command = resolved
+		}
+	}
+	return strings.TrimSuffix(filepath.Base(command), ".wrapper")
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/triiberg/smartpasta/internal/history"
+)
+
+// setEntries replaces the full entry list and re-applies the current filter.
+func (u *ui) setEntries(entries []history.Entry) {
+	u.state.allEntries = entries
+	u.applyFilter()
+}
+
+// applyFilter narrows the visible entries to fuzzy matches of the query,
+// best match first and most recent first on ties.
+func (u *ui) applyFilter() {
+	u.state.selectedIndex = 0
+	u.state.visibleTop = 0
+
+	query := string(u.state.query)
+	if query == "" {
+		u.state.entries = u.state.allEntries
+		u.state.matchPositions = nil
+		u.selectionEnabled = len(u.state.entries) > 0
+		return
+	}
+
+	type scored struct {
+		entry     history.Entry
+		score     int
+		positions []int
+	}
+	results := make([]scored, 0, len(u.state.allEntries))
+	for _, entry := range u.state.allEntries {
+		if entry.Sensitive {
+			continue
+		}
+		if score, positions, ok := history.FuzzyMatch(query, entry.Content); ok {
+			results = append(results, scored{entry: entry, score: score, positions: positions})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+
+	u.state.entries = make([]history.Entry, len(results))
+	u.state.matchPositions = make([][]int, len(results))
+	for i, result := range results {
+		u.state.entries[i] = result.entry
+		u.state.matchPositions[i] = result.positions
+	}
+	u.selectionEnabled = len(u.state.entries) > 0
+}
+
+// handleFilterKey edits the query for printable keys and Backspace and
+// reports whether the key was consumed. The first printable key that is not
+// a navigation key starts filtering; "/" starts it explicitly so queries can
+// begin with j, k, g or a digit.
+func (u *ui) handleFilterKey(keymap *keymap, ev xproto.KeyPressEvent) bool {
+	if keymap.matches(ev.Detail, keysymBack) {
+		if len(u.state.query) > 0 {
+			u.state.query = u.state.query[:len(u.state.query)-1]
+			u.applyFilter()
+		} else {
+			u.state.filtering = false
+		}
+		return true
+	}
+	if ev.State&(xproto.ModMaskControl|xproto.ModMask1) != 0 {
+		return false
+	}
+	r, ok := keysymRune(keymap.lookup(ev.Detail, ev.State))
+	if !ok {
+		return false
+	}
+	if !u.state.filtering {
+		u.state.filtering = true
+		if r == '/' {
+			return true
+		}
+	}
+	u.state.query = append(u.state.query, r)
+	u.applyFilter()
+	return true
+}
+
+func (u *ui) drawSearchLine(conn *xgb.Conn) {
+	baseline := u.searchTop() + u.baseline
+	if !u.state.filtering {
+		u.drawText(conn, u.padding, baseline, "> type or / to filter", u.footerTextGC)
+		return
+	}
+	u.drawText(conn, u.padding, baseline, "> "+string(u.state.query)+"_", u.textGC)
+}
+
+// drawMatches redraws the matched characters of a preview on top of the
+// already drawn line.
+func (u *ui) drawMatches(conn *xgb.Conn, x int, baseline int, content string, positions []int, gc xproto.Gcontext) {
+	if len(positions) == 0 {
+		return
+	}
+	line := flattenLine(content)
+	offset := len(line) - len(strings.TrimLeftFunc(line, unicode.IsSpace))
+	preview := previewLine(content)
+	_, visible := u.text.fit(preview, u.state.width-u.padding-x)
+	for _, pos := range positions {
+		idx := pos - offset
+		if idx < 0 || idx >= visible {
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(preview[idx:])
+		u.text.draw(conn, xproto.Drawable(u.window), gc, x+u.text.width(preview[:idx]), baseline, preview[idx:idx+size])
+	}
+}
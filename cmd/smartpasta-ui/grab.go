@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+const (
+	grabAttempts   = 50
+	grabRetryDelay = 20 * time.Millisecond
+)
+
+// grabInput takes an active keyboard grab so keystrokes reach the picker
+// even while the launching hotkey is still held or another client holds
+// focus, then grabs the pointer. Both are retried for about a second since
+// the window manager usually still has its hotkey grab active at startup.
+func (u *ui) grabInput(conn *xgb.Conn) error {
+	var err error
+	for attempt := 0; attempt < grabAttempts; attempt++ {
+		if err = u.grabKeyboard(conn); err == nil {
+			u.keyboardGrabbed = true
+			break
+		}
+		time.Sleep(grabRetryDelay)
+	}
+	for attempt := 0; attempt < grabAttempts; attempt++ {
+		if u.grabPointer(conn) == nil {
+			u.pointerGrabbed = true
+			break
+		}
+		time.Sleep(grabRetryDelay)
+	}
+	return err
+}
+
+func (u *ui) grabKeyboard(conn *xgb.Conn) error {
+	reply, err := xproto.GrabKeyboard(
+		conn,
+		true,
+		u.window,
+		xproto.TimeCurrentTime,
+		xproto.GrabModeAsync,
+		xproto.GrabModeAsync,
+	).Reply()
+	if err != nil {
+		return err
+	}
+	if reply.Status != xproto.GrabStatusSuccess {
+		return fmt.Errorf("grab keyboard: status %d", reply.Status)
+	}
+	return nil
+}
+
+// releaseGrabs drops any grabs the picker holds. It is safe to call more
+// than once.
+func (u *ui) releaseGrabs(conn *xgb.Conn) {
+	if u.keyboardGrabbed {
+		_ = xproto.UngrabKeyboardChecked(conn, xproto.TimeCurrentTime).Check()
+		u.keyboardGrabbed = false
+	}
+	if u.pointerGrabbed {
+		_ = xproto.UngrabPointerChecked(conn, xproto.TimeCurrentTime).Check()
+		u.pointerGrabbed = false
+	}
+}
+
+// lostFocus reports whether a FocusOut means the picker should close:
+// focus really moved to another window, or our keyboard grab was broken.
+// Focus moving to a passive grab (e.g. a window manager hotkey) while we
+// could not grab is temporary and ignored.
+func (u *ui) lostFocus(ev xproto.FocusOutEvent) bool {
+	if ev.Event != u.window || ev.Detail == xproto.NotifyDetailInferior || ev.Detail == xproto.NotifyDetailPointer {
+		return false
+	}
+	switch ev.Mode {
+	case xproto.NotifyModeNormal, xproto.NotifyModeWhileGrabbed:
+		return true
+	case xproto.NotifyModeUngrab:
+		return u.keyboardGrabbed
+	}
+	return false
+}
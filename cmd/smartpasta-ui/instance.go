@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// instanceSelection is owned by the open picker's window so a second
+// invocation can find it and ask it to close or cycle instead of stacking a
+// new picker on top.
+const instanceSelection = "_SMARTPASTA_PICKER"
+
+const (
+	commandClose uint32 = iota
+	commandCycle
+)
+
+// signalRunning sends command to an already open picker and reports
+// whether there was one.
+func signalRunning(conn *xgb.Conn, command uint32) (bool, error) {
+	atom, err := internAtom(conn, instanceSelection)
+	if err != nil {
+		return false, err
+	}
+	owner, err := xproto.GetSelectionOwner(conn, atom).Reply()
+	if err != nil {
+		return false, err
+	}
+	if owner.Owner == xproto.WindowNone {
+		return false, nil
+	}
+	// With an empty event mask the event goes to the client that created
+	// the window.
+	data := xproto.ClientMessageDataUnionData32New([]uint32{command, 0, 0, 0, 0})
+	event := xproto.ClientMessageEvent{Format: 32, Window: owner.Owner, Type: atom, Data: data}
+	if err := xproto.SendEventChecked(conn, false, owner.Owner, 0, string(event.Bytes())).Check(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// claimInstance makes the picker window the owner of the instance
+// selection. It fails when another picker won a concurrent start.
+func (u *ui) claimInstance(conn *xgb.Conn) error {
+	atom, err := internAtom(conn, instanceSelection)
+	if err != nil {
+		return err
+	}
+	if err := xproto.SetSelectionOwnerChecked(conn, u.window, atom, xproto.TimeCurrentTime).Check(); err != nil {
+		return err
+	}
+	owner, err := xproto.GetSelectionOwner(conn, atom).Reply()
+	if err != nil {
+		return err
+	}
+	if owner.Owner != u.window {
+		return fmt.Errorf("another picker is open")
+	}
+	u.instanceAtom = atom
+	return nil
+}
+
+// handleInstanceCommand applies a command from a second invocation and
+// reports whether the picker should close.
+func (u *ui) handleInstanceCommand(ev xproto.ClientMessageEvent) bool {
+	if u.instanceAtom == 0 || ev.Type != u.instanceAtom || ev.Format != 32 {
+		return false
+	}
+	if ev.Data.Data32[0] == commandCycle {
+		u.cycleSelection()
+		return false
+	}
+	return true
+}
+
+// handleHotkey treats the picker's own hotkey, which the keyboard grab
+// keeps from reaching the window manager, like a second invocation.
+func (u *ui) handleHotkey(keymap *keymap, ev xproto.KeyPressEvent) (bool, bool) {
+	if u.hotkey == nil || !u.hotkey.matches(keymap, ev) {
+		return false, false
+	}
+	if u.cycle {
+		u.cycleSelection()
+		return true, false
+	}
+	return true, true
+}
+
+// cycleSelection moves the highlight to the next entry, wrapping around.
+func (u *ui) cycleSelection() {
+	if u.state.tab != tabHistory || len(u.state.entries) == 0 {
+		return
+	}
+	if u.state.selectedIndex == len(u.state.entries)-1 {
+		u.moveSelection(-len(u.state.entries))
+		return
+	}
+	u.moveSelection(1)
+}
+
+type hotkey struct {
+	sym  xproto.Keysym
+	mods uint16
+}
+
+func parseHotkey(spec string) (*hotkey, error) {
+	keys, err := parseKeys(spec)
+	if err != nil {
+		return nil, err
+	}
+	h := &hotkey{}
+	for _, key := range keys {
+		switch key {
+		case keysymControlL:
+			h.mods |= xproto.ModMaskControl
+		case keysymShiftL:
+			h.mods |= xproto.ModMaskShift
+		case keysymAltL:
+			h.mods |= xproto.ModMask1
+		case keysymSuperL:
+			h.mods |= xproto.ModMask4
+		default:
+			h.sym = key
+		}
+	}
+	if h.sym == 0 {
+		return nil, fmt.Errorf("hotkey %q has no key", spec)
+	}
+	return h, nil
+}
+
+func (h *hotkey) matches(keymap *keymap, ev xproto.KeyPressEvent) bool {
+	mods := ev.State & (xproto.ModMaskControl | xproto.ModMaskShift | xproto.ModMask1 | xproto.ModMask4)
+	if mods != h.mods {
+		return false
+	}
+	sym := h.sym
+	if sym >= 'a' && sym <= 'z' {
+		return keymap.matches(ev.Detail, sym, sym-'a'+'A')
+	}
+	return keymap.matches(ev.Detail, sym)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+
+	"github.com/BurntSushi/xgb"
+
+	"github.com/triiberg/smartpasta/internal/history"
+	"github.com/triiberg/smartpasta/pkg/smartpasta"
+)
+
+type xEvent struct {
+	event xgb.Event
+	err   error
+}
+
+// xEvents delivers X events on a channel so the event loop can also wait
+// for daemon changes. The channel is closed when the connection closes.
+func xEvents(conn *xgb.Conn) <-chan xEvent {
+	events := make(chan xEvent)
+	go func() {
+		defer close(events)
+		for {
+			event, err := conn.WaitForEvent()
+			if event == nil && err == nil {
+				return
+			}
+			events <- xEvent{event: event, err: err}
+		}
+	}()
+	return events
+}
+
+// subscribe delivers the daemon's changes to all boards on a channel. The
+// channel is nil when the daemon cannot stream them and is closed when the
+// stream ends.
+func subscribe(daemon *smartpasta.Client) <-chan history.Change {
+	sub, err := daemon.Subscribe(context.Background(), "")
+	if err != nil {
+		return nil
+	}
+	changes := make(chan history.Change)
+	go func() {
+		defer close(changes)
+		defer sub.Close()
+		for {
+			change, err := sub.Next(context.Background())
+			if err != nil {
+				return
+			}
+			changes <- change
+		}
+	}()
+	return changes
+}
+
+// applyChange folds a change streamed by the daemon into the entry list,
+// keeping the highlight on the same entry. It reports whether the list
+// changed.
+func (u *ui) applyChange(board string, change history.Change) bool {
+	if change.Board != board {
+		return false
+	}
+	entries := make([]history.Entry, 0, len(u.state.allEntries)+1)
+	switch change.Type {
+	case history.ChangeAdded, history.ChangeSelected:
+		if change.Entry == nil || u.pendingDelete(change.Entry.ID) {
+			return false
+		}
+		entries = append(entries, *change.Entry)
+		for _, entry := range u.state.allEntries {
+			if entry.ID != change.Entry.ID {
+				entries = append(entries, entry)
+			}
+		}
+	case history.ChangeUpdated:
+		if change.Entry == nil {
+			return false
+		}
+		for _, entry := range u.state.allEntries {
+			if entry.ID == change.Entry.ID {
+				entry = *change.Entry
+			}
+			entries = append(entries, entry)
+		}
+	case history.ChangeDeleted:
+		for _, entry := range u.state.allEntries {
+			if entry.ID != change.ID {
+				entries = append(entries, entry)
+			}
+		}
+	case history.ChangeCleared:
+		for _, entry := range u.state.allEntries {
+			if entry.Pinned {
+				entries = append(entries, entry)
+			}
+		}
+	default:
+		return false
+	}
+	u.keepHighlight(entries)
+	return true
+}
+
+// keepHighlight replaces the entry list and moves the highlight to wherever
+// the highlighted entry ended up. If it is gone the highlight stays at the
+// same row and an open transform menu is closed, since it was for that
+// entry.
+func (u *ui) keepHighlight(entries []history.Entry) {
+	index := u.state.selectedIndex
+	var highlighted int64 = -1
+	if u.selectionEnabled && index < len(u.state.entries) {
+		highlighted = u.state.entries[index].ID
+	}
+	u.replaceEntries(entries, index)
+	for i, entry := range u.state.entries {
+		if entry.ID == highlighted {
+			u.state.selectedIndex = i
+			u.moveSelection(0)
+			return
+		}
+	}
+	u.menu = nil
+}
+
+// leaveDeletedBoard moves the picker to the default board once the board it
+// shows has been deleted. Deletes still pending went with the board.
+func (u *ui) leaveDeletedBoard(daemon *smartpasta.Client) {
+	u.deleted = nil
+	u.menu = nil
+	daemon.Board = history.DefaultBoard
+	u.boardName = history.DefaultBoard
+	// On error the deleted board's entries still have to go.
+	entries, _ := daemon.History(context.Background())
+	u.setEntries(entries)
+}
+
+func (u *ui) pendingDelete(id int64) bool {
+	for _, d := range u.deleted {
+		if d.entry.ID == id {
+			return true
+		}
+	}
+	return false
+}
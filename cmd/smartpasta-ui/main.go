@@ -1,29 +1,22 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
-	"errors"
+	"context"
 	"flag"
 	"fmt"
-	"net"
 	"os"
-	"path/filepath"
 	"strings"
-	"time"
+	"unicode/utf8"
 
 	"github.com/BurntSushi/xgb"
 	"github.com/BurntSushi/xgb/xproto"
 
-	"smartpasta/internal/history"
-)
-
-const (
-	defaultWidth      = 640
-	defaultLineHeight = 18
-	padding           = 10
-	footerHeight      = 18
-	maxPreviewChars   = 80
+	"github.com/triiberg/smartpasta/internal/classify"
+	"github.com/triiberg/smartpasta/internal/config"
+	"github.com/triiberg/smartpasta/internal/history"
+	"github.com/triiberg/smartpasta/internal/snippet"
+	"github.com/triiberg/smartpasta/internal/transform"
+	"github.com/triiberg/smartpasta/pkg/smartpasta"
 )
 
 const (
@@ -31,96 +24,19 @@ const (
 	keysymDown   xproto.Keysym = 0xff54
 	keysymReturn xproto.Keysym = 0xff0d
 	keysymEscape xproto.Keysym = 0xff1b
+	keysymLeft   xproto.Keysym = 0xff51
+	keysymRight  xproto.Keysym = 0xff53
+	keysymBack   xproto.Keysym = 0xff08
 	keysymD      xproto.Keysym = 0x0044
 	keysymd      xproto.Keysym = 0x0064
+	keysymT      xproto.Keysym = 0x0054
+	keysymt      xproto.Keysym = 0x0074
+	keysymB      xproto.Keysym = 0x0042
+	keysymb      xproto.Keysym = 0x0062
+	keysymE      xproto.Keysym = 0x0045
+	keysyme      xproto.Keysym = 0x0065
 )
 
-type request struct {
-	Op string `json:"op"`
-	ID int64  `json:"id,omitempty"`
-}
-
-type response struct {
-	Ok      bool            `json:"ok"`
-	Error   string          `json:"error,omitempty"`
-	Entries []history.Entry `json:"entries,omitempty"`
-}
-
-type ipcClient struct {
-	conn   net.Conn
-	reader *bufio.Reader
-	writer *bufio.Writer
-}
-
-func newIPCClient(socketPath string) (*ipcClient, error) {
-	conn, err := net.DialTimeout("unix", socketPath, 500*time.Millisecond)
-	if err != nil {
-		return nil, err
-	}
-	return &ipcClient{
-		conn:   conn,
-		reader: bufio.NewReader(conn),
-		writer: bufio.NewWriter(conn),
-	}, nil
-}
-
-func (c *ipcClient) Close() {
-	if c.conn != nil {
-		_ = c.conn.Close()
-	}
-}
-
-func (c *ipcClient) do(req request, resp *response) error {
-	data, err := json.Marshal(req)
-	if err != nil {
-		return err
-	}
-	if _, err := c.writer.WriteString(string(data) + "\n"); err != nil {
-		return err
-	}
-	if err := c.writer.Flush(); err != nil {
-		return err
-	}
-	line, err := c.reader.ReadString('\n')
-	if err != nil {
-		return err
-	}
-	return json.Unmarshal([]byte(strings.TrimSpace(line)), resp)
-}
-
-func (c *ipcClient) history() ([]history.Entry, error) {
-	var resp response
-	if err := c.do(request{Op: "history"}, &resp); err != nil {
-		return nil, err
-	}
-	if !resp.Ok {
-		return nil, errors.New(resp.Error)
-	}
-	return resp.Entries, nil
-}
-
-func (c *ipcClient) selectEntry(id int64) error {
-	var resp response
-	if err := c.do(request{Op: "select", ID: id}, &resp); err != nil {
-		return err
-	}
-	if !resp.Ok {
-		return errors.New(resp.Error)
-	}
-	return nil
-}
-
-func (c *ipcClient) dump() error {
-	var resp response
-	if err := c.do(request{Op: "dump"}, &resp); err != nil {
-		return err
-	}
-	if !resp.Ok {
-		return errors.New(resp.Error)
-	}
-	return nil
-}
-
 type keymap struct {
 	minKeycode xproto.Keycode
 	maxKeycode xproto.Keycode
@@ -164,49 +80,134 @@ func (k *keymap) matches(keycode xproto.Keycode, targets ...xproto.Keysym) bool
 	return false
 }
 
+// keycode returns the first keycode producing sym.
+func (k *keymap) keycode(sym xproto.Keysym) (xproto.Keycode, bool) {
+	if k.perCode == 0 {
+		return 0, false
+	}
+	for i, candidate := range k.keysyms {
+		if candidate == sym {
+			return k.minKeycode + xproto.Keycode(i/k.perCode), true
+		}
+	}
+	return 0, false
+}
+
+// lookup returns the keysym for keycode, honouring Shift for the second
+// column of the keyboard mapping.
+func (k *keymap) lookup(keycode xproto.Keycode, state uint16) xproto.Keysym {
+	if keycode < k.minKeycode || keycode > k.maxKeycode {
+		return 0
+	}
+	start := int(keycode-k.minKeycode) * k.perCode
+	if start < 0 || start+k.perCode > len(k.keysyms) || k.perCode == 0 {
+		return 0
+	}
+	if state&xproto.ModMaskShift != 0 && k.perCode > 1 && k.keysyms[start+1] != 0 {
+		return k.keysyms[start+1]
+	}
+	return k.keysyms[start]
+}
+
+// keysymRune maps Latin-1 keysyms to their character; other keysyms are not
+// printable.
+func keysymRune(sym xproto.Keysym) (rune, bool) {
+	if (sym >= 0x20 && sym <= 0x7e) || (sym >= 0xa0 && sym <= 0xff) {
+		return rune(sym), true
+	}
+	return 0, false
+}
+
 type uiState struct {
-	entries       []history.Entry
+	allEntries     []history.Entry
+	entries        []history.Entry
+	matchPositions [][]int
+	query          []rune
+	filtering      bool
+	selectedIndex  int
+	visibleTop     int
+	visibleCount   int
+	width          int
+	height         int
+	tab            int
+	snippets       []snippet.Snippet
+	snippetCursor  listCursor
+}
+
+const (
+	tabHistory = iota
+	tabSnippets
+)
+
+type listCursor struct {
 	selectedIndex int
 	visibleTop    int
-	visibleCount  int
-	width         int
-	height        int
+}
+
+type transformMenu struct {
+	items  []transform.Transform
+	cursor listCursor
 }
 
 func main() {
+	cfg := config.Default()
+	if path, err := config.DefaultPath(); err == nil {
+		loaded, err := config.Load(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ignoring config: %v\n", err)
+		} else {
+			cfg = loaded
+		}
+	}
+
 	display := flag.String("display", "", "X11 display to use (overrides DISPLAY)")
+	board := flag.String("board", "", "board to show (default: the active board)")
+	autoPaste := flag.Bool("paste", cfg.Paste.Enabled, "paste the selection into the previously focused window")
+	cycle := flag.Bool("cycle", cfg.UI.Cycle, "when a picker is already open, move its highlight instead of closing it")
 	flag.Parse()
 
-	cacheDir, err := os.UserCacheDir()
+	conn, err := openConn(*display)
 	if err != nil {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "failed to determine cache directory")
-			os.Exit(1)
-		}
-		cacheDir = filepath.Join(homeDir, ".cache")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	command := commandClose
+	if *cycle {
+		command = commandCycle
+	}
+	if running, err := signalRunning(conn, command); err == nil && running {
+		return
 	}
-	socketPath := filepath.Join(cacheDir, "smartpasta", "smartpasta.sock")
 
-	client, err := newIPCClient(socketPath)
+	daemon, err := smartpasta.Dial(context.Background(), "")
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "failed to connect to smartpasta daemon")
 		os.Exit(1)
 	}
-	defer client.Close()
+	defer daemon.Close()
+	daemon.Board = *board
 
-	entries, err := client.history()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "failed to fetch history")
-		os.Exit(1)
+	if daemon.Board == "" {
+		// Pin the session to the board that was active on open, so a switch
+		// from elsewhere does not change what Enter acts on.
+		if active, err := daemon.ActiveBoard(context.Background()); err == nil {
+			daemon.Board = active
+		}
 	}
 
-	conn, err := openConn(*display)
+	// Subscribe before fetching so nothing that happens while the picker
+	// opens is missed; changes already in the fetched list apply cleanly
+	// twice, in order. Live updates are optional: without them the list is
+	// what was fetched here.
+	changes := subscribe(daemon)
+
+	entries, err := daemon.History(context.Background())
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, "failed to fetch history")
 		os.Exit(1)
 	}
-	defer conn.Close()
 
 	keymap, err := newKeymap(conn)
 	if err != nil {
@@ -214,13 +215,38 @@ func main() {
 		os.Exit(1)
 	}
 
-	ui, err := newUI(conn, entries)
+	// The paste target must be read before the picker takes focus.
+	var paste *pasteTarget
+	if *autoPaste {
+		paste, err = newPasteTarget(conn, cfg.Paste)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	// Snippets are optional; an older daemon or an empty library just hides
+	// the tab.
+	snippets, _ := daemon.Snippets(context.Background())
+
+	ui, err := newUI(conn, cfg.UI, entries, snippets)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	ui.boardName = daemon.Board
+	ui.paste = paste
+	ui.cycle = *cycle
+	if cfg.UI.Hotkey != "" {
+		if ui.hotkey, err = parseHotkey(cfg.UI.Hotkey); err != nil {
+			fmt.Fprintf(os.Stderr, "ignoring hotkey: %v\n", err)
+		}
+	}
+	if err := ui.claimInstance(conn); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-	if err := ui.run(conn, keymap, client); err != nil {
+	if err := ui.run(conn, keymap, daemon, changes); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -245,26 +271,77 @@ type ui struct {
 	highlightGC      xproto.Gcontext
 	highlightTextGC  xproto.Gcontext
 	footerTextGC     xproto.Gcontext
-	font             xproto.Font
-	lineHeight       int
+	matchGC          xproto.Gcontext
+	matchHighlightGC xproto.Gcontext
+	swatchGCs        map[string]xproto.Gcontext
+	colormap         xproto.Colormap
+	text             *textRenderer
+	metrics
 	footerText       string
 	selectionEnabled bool
+	menu             *transformMenu
+	prompt           *snippetPrompt
+	boardName        string
+	paste            *pasteTarget
+	pendingG         bool
+	bounds           rect
+	originY          int
+	previewLines     int
+	listRows         int
+	deleted          []deletedEntry
+	confirmClear     bool
+	keyboardGrabbed  bool
+	pointerGrabbed   bool
+	instanceAtom     xproto.Atom
+	hotkey           *hotkey
+	cycle            bool
+	// failure is a failed action's message, shown in place of the footer
+	// hint until the next key press.
+	failure string
 }
 
-func newUI(conn *xgb.Conn, entries []history.Entry) (*ui, error) {
+func newUI(conn *xgb.Conn, cfg config.UIConfig, entries []history.Entry, snippets []snippet.Snippet) (*ui, error) {
 	setup := xproto.Setup(conn)
 	screen := setup.DefaultScreen(conn)
 
-	width := defaultWidth
-	if width > int(screen.WidthInPixels) {
-		width = int(screen.WidthInPixels)
+	root := screen.Root
+	query, err := xproto.QueryPointer(conn, root).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("query pointer: %w", err)
+	}
+	bounds := pickerBounds(conn, screen, int(query.RootX), int(query.RootY))
+
+	scale := cfg.Scale
+	if scale == 0 {
+		scale = dpiScale(conn, root)
+	}
+	text, err := newTextRenderer(conn, fontNames(cfg, scale)...)
+	if err != nil {
+		return nil, err
+	}
+	m := newMetrics(text, cfg, scale)
+
+	width := scaled(cfg.Width, scale)
+	if width > bounds.width {
+		width = bounds.width
 	}
 
 	visibleCount := len(entries)
+	if len(snippets) > visibleCount {
+		visibleCount = len(snippets)
+	}
 	if visibleCount == 0 {
 		visibleCount = 1
 	}
-	maxVisible := (int(screen.HeightInPixels) - (2*padding + footerHeight)) / defaultLineHeight
+	// The search line is always shown; the tab bar only with snippets.
+	header := m.lineHeight
+	if len(snippets) > 0 {
+		header += m.lineHeight
+	}
+	maxVisible := (bounds.height - (2*m.padding + m.footerHeight + header)) / m.lineHeight
+	if cfg.MaxRows > 0 && maxVisible > cfg.MaxRows {
+		maxVisible = cfg.MaxRows
+	}
 	if maxVisible < 1 {
 		maxVisible = 1
 	}
@@ -272,30 +349,24 @@ func newUI(conn *xgb.Conn, entries []history.Entry) (*ui, error) {
 		visibleCount = maxVisible
 	}
 
-	height := padding*2 + visibleCount*defaultLineHeight + footerHeight
-	if height > int(screen.HeightInPixels) {
-		height = int(screen.HeightInPixels)
-	}
-
-	root := screen.Root
-	query, err := xproto.QueryPointer(conn, root).Reply()
-	if err != nil {
-		return nil, fmt.Errorf("query pointer: %w", err)
+	height := m.padding*2 + header + visibleCount*m.lineHeight + m.footerHeight
+	if height > bounds.height {
+		height = bounds.height
 	}
 
 	x := int(query.RootX)
 	y := int(query.RootY)
-	if x+width > int(screen.WidthInPixels) {
-		x = int(screen.WidthInPixels) - width
+	if x+width > bounds.x+bounds.width {
+		x = bounds.x + bounds.width - width
 	}
-	if y+height > int(screen.HeightInPixels) {
-		y = int(screen.HeightInPixels) - height
+	if y+height > bounds.y+bounds.height {
+		y = bounds.y + bounds.height - height
 	}
-	if x < 0 {
-		x = 0
+	if x < bounds.x {
+		x = bounds.x
 	}
-	if y < 0 {
-		y = 0
+	if y < bounds.y {
+		y = bounds.y
 	}
 
 	window, err := xproto.NewWindowId(conn)
@@ -306,7 +377,7 @@ func newUI(conn *xgb.Conn, entries []history.Entry) (*ui, error) {
 	mask := uint32(xproto.CwBackPixel | xproto.CwEventMask | xproto.CwOverrideRedirect)
 	values := []uint32{
 		screen.BlackPixel,
-		xproto.EventMaskExposure | xproto.EventMaskKeyPress,
+		xproto.EventMaskExposure | xproto.EventMaskKeyPress | xproto.EventMaskButtonPress | xproto.EventMaskPointerMotion | xproto.EventMaskFocusChange,
 		1,
 	}
 
@@ -328,12 +399,9 @@ func newUI(conn *xgb.Conn, entries []history.Entry) (*ui, error) {
 		return nil, fmt.Errorf("create window: %w", err)
 	}
 
-	font, err := xproto.NewFontId(conn)
-	if err == nil {
-		_ = xproto.OpenFontChecked(conn, font, uint16(len("fixed")), "fixed").Check()
-	}
+	font := text.font
 
-	colors, err := newColors(conn, screen.DefaultColormap)
+	colors, err := newColors(conn, screen.DefaultColormap, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -358,26 +426,42 @@ func newUI(conn *xgb.Conn, entries []history.Entry) (*ui, error) {
 	if err != nil {
 		return nil, err
 	}
+	matchGC, err := createGC(conn, window, colors.match, colors.background, font)
+	if err != nil {
+		return nil, err
+	}
+	matchHighlightGC, err := createGC(conn, window, colors.match, colors.highlight, font)
+	if err != nil {
+		return nil, err
+	}
 
 	return &ui{
 		window: window,
 		state: uiState{
+			allEntries:    entries,
 			entries:       entries,
 			selectedIndex: 0,
 			visibleTop:    0,
 			visibleCount:  visibleCount,
 			width:         width,
 			height:        height,
+			snippets:      snippets,
 		},
 		bgGC:             bgGC,
 		textGC:           textGC,
 		highlightGC:      highlightGC,
 		highlightTextGC:  highlightTextGC,
 		footerTextGC:     footerTextGC,
-		font:             font,
-		lineHeight:       defaultLineHeight,
-		footerText:       "Enter: select  Esc: close  D: dump",
+		matchGC:          matchGC,
+		matchHighlightGC: matchHighlightGC,
+		swatchGCs:        make(map[string]xproto.Gcontext),
+		colormap:         screen.DefaultColormap,
+		text:             text,
+		metrics:          m,
+		footerText:       "Enter: select  Tab: preview  Del: delete  Ctrl+Z: undo  Ctrl+P: pin  Ctrl+B: board  Alt+T/E/D: transform/edit/dump",
 		selectionEnabled: len(entries) > 0,
+		bounds:           bounds,
+		originY:          y,
 	}, nil
 }
 
@@ -387,36 +471,29 @@ type uiColors struct {
 	highlight     uint32
 	highlightText uint32
 	footerText    uint32
+	match         uint32
 }
 
-func newColors(conn *xgb.Conn, colormap xproto.Colormap) (*uiColors, error) {
-	background, err := allocColor(conn, colormap, "1e1e1e")
-	if err != nil {
-		return nil, err
-	}
-	text, err := allocColor(conn, colormap, "e0e0e0")
-	if err != nil {
-		return nil, err
-	}
-	highlight, err := allocColor(conn, colormap, "2f5d8a")
-	if err != nil {
-		return nil, err
-	}
-	highlightText, err := allocColor(conn, colormap, "ffffff")
-	if err != nil {
-		return nil, err
-	}
-	footerText, err := allocColor(conn, colormap, "aaaaaa")
-	if err != nil {
-		return nil, err
+func newColors(conn *xgb.Conn, colormap xproto.Colormap, cfg config.UIConfig) (*uiColors, error) {
+	colors := &uiColors{}
+	for _, c := range []struct {
+		pixel *uint32
+		hex   string
+	}{
+		{&colors.background, cfg.Background},
+		{&colors.text, cfg.Text},
+		{&colors.highlight, cfg.Highlight},
+		{&colors.highlightText, cfg.HighlightText},
+		{&colors.footerText, cfg.FooterText},
+		{&colors.match, cfg.Match},
+	} {
+		pixel, err := allocColor(conn, colormap, c.hex)
+		if err != nil {
+			return nil, err
+		}
+		*c.pixel = pixel
 	}
-	return &uiColors{
-		background:    background,
-		text:          text,
-		highlight:     highlight,
-		highlightText: highlightText,
-		footerText:    footerText,
-	}, nil
+	return colors, nil
 }
 
 func allocColor(conn *xgb.Conn, colormap xproto.Colormap, hex string) (uint32, error) {
@@ -466,48 +543,275 @@ func createGC(conn *xgb.Conn, window xproto.Window, fg uint32, bg uint32, font x
 	return gc, nil
 }
 
-func (u *ui) run(conn *xgb.Conn, keymap *keymap, client *ipcClient) error {
+func (u *ui) run(conn *xgb.Conn, keymap *keymap, daemon *smartpasta.Client, changes <-chan history.Change) error {
 	if err := xproto.MapWindowChecked(conn, u.window).Check(); err != nil {
 		return err
 	}
 	_ = xproto.SetInputFocusChecked(conn, xproto.InputFocusPointerRoot, u.window, xproto.TimeCurrentTime).Check()
+	// Without the grabs the picker still works through input focus alone,
+	// it just cannot notice clicks outside itself.
+	_ = u.grabInput(conn)
+	defer u.releaseGrabs(conn)
+	defer u.flushDeletes(daemon)
 	u.draw(conn)
 
+	events := xEvents(conn)
 	for {
-		event, err := conn.WaitForEvent()
-		if err != nil {
-			return err
+		var event xgb.Event
+		select {
+		case change, ok := <-changes:
+			if !ok {
+				changes = nil
+				continue
+			}
+			if change.Type == history.ChangeBoardDeleted && change.Board == daemon.Board {
+				u.leaveDeletedBoard(daemon)
+				u.draw(conn)
+			} else if u.applyChange(daemon.Board, change) {
+				u.draw(conn)
+			}
+			continue
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if ev.err != nil {
+				return ev.err
+			}
+			event = ev.event
 		}
 		switch ev := event.(type) {
 		case xproto.ExposeEvent:
 			u.draw(conn)
+		case xproto.ButtonPressEvent:
+			done, index := u.handleButton(ev)
+			if index >= 0 {
+				return u.selectEntry(conn, keymap, daemon, index)
+			}
+			if done {
+				return nil
+			}
+			u.draw(conn)
+		case xproto.ClientMessageEvent:
+			if u.handleInstanceCommand(ev) {
+				return nil
+			}
+			u.draw(conn)
+		case xproto.SelectionClearEvent:
+			if ev.Selection == u.instanceAtom {
+				return nil
+			}
+		case xproto.FocusOutEvent:
+			if u.lostFocus(ev) {
+				return nil
+			}
+		case xproto.MotionNotifyEvent:
+			if u.handleMotion(ev) {
+				u.draw(conn)
+			}
 		case xproto.KeyPressEvent:
+			u.failure = ""
+			if consumed, done := u.handleHotkey(keymap, ev); consumed {
+				if done {
+					return nil
+				}
+				u.draw(conn)
+				continue
+			}
+			if u.menu != nil {
+				done, err := u.handleMenuKey(keymap, ev, daemon)
+				if err != nil || done {
+					return err
+				}
+				u.draw(conn)
+				continue
+			}
+			if u.prompt != nil {
+				done, err := u.handlePromptKey(keymap, ev, daemon)
+				if err != nil || done {
+					return err
+				}
+				u.draw(conn)
+				continue
+			}
+			if u.confirmClear {
+				u.handleConfirmKey(keymap, ev, daemon)
+				u.draw(conn)
+				continue
+			}
+			pendingG := u.pendingG
+			u.pendingG = false
 			if keymap.matches(ev.Detail, keysymEscape) {
+				if u.state.filtering && u.state.tab == tabHistory {
+					u.state.query = nil
+					u.state.filtering = false
+					u.applyFilter()
+					u.draw(conn)
+					continue
+				}
 				return nil
 			}
-			if keymap.matches(ev.Detail, keysymUp) {
-				u.moveSelection(-1)
+			if ev.State&xproto.ModMaskControl != 0 && keymap.matches(ev.Detail, keysymB, keysymb) {
+				u.nextBoard(daemon)
+				u.draw(conn)
+				continue
+			}
+			if len(u.state.snippets) > 0 && keymap.matches(ev.Detail, keysymLeft, keysymRight) {
+				u.state.tab = (u.state.tab + 1) % 2
+				u.draw(conn)
+				continue
+			}
+			if u.state.tab == tabSnippets {
+				done, err := u.handleSnippetKey(keymap, ev, daemon)
+				if err != nil || done {
+					return err
+				}
+				u.draw(conn)
+				continue
+			}
+			if u.handleEditKey(keymap, ev, daemon) {
 				u.draw(conn)
 				continue
 			}
-			if keymap.matches(ev.Detail, keysymDown) {
-				u.moveSelection(1)
+			if keymap.matches(ev.Detail, keysymTab) {
+				u.togglePreview(conn)
+				u.draw(conn)
+				continue
+			}
+			if consumed, index := u.handleNavigationKey(keymap, ev, pendingG); consumed {
+				if index >= 0 {
+					return u.selectEntry(conn, keymap, daemon, index)
+				}
 				u.draw(conn)
 				continue
 			}
 			if keymap.matches(ev.Detail, keysymReturn) {
-				if u.selectionEnabled {
-					entry := u.state.entries[u.state.selectedIndex]
-					_ = client.selectEntry(entry.ID)
+				if !u.selectionEnabled {
+					return nil
 				}
-				return nil
+				return u.selectEntry(conn, keymap, daemon, u.state.selectedIndex)
 			}
-			if keymap.matches(ev.Detail, keysymD, keysymd) {
-				_ = client.dump()
+			alt := ev.State&xproto.ModMask1 != 0
+			if alt && keymap.matches(ev.Detail, keysymD, keysymd) {
+				u.flushDeletes(daemon)
+				_ = daemon.Dump(context.Background())
 				return nil
 			}
+			if alt && keymap.matches(ev.Detail, keysymE, keysyme) && u.selectionEnabled {
+				return u.editSelected(conn, daemon)
+			}
+			if alt && keymap.matches(ev.Detail, keysymT, keysymt) && u.selectionEnabled {
+				u.menu = &transformMenu{items: transform.List()}
+				u.draw(conn)
+				continue
+			}
+			if u.handleFilterKey(keymap, ev) {
+				u.draw(conn)
+			}
+		}
+	}
+}
+
+// selectEntry makes the entry at index the clipboard and, in auto-paste
+// mode, pastes it into the previously focused window.
+func (u *ui) selectEntry(conn *xgb.Conn, keymap *keymap, daemon *smartpasta.Client, index int) error {
+	entry := u.state.entries[index]
+	if err := daemon.Select(context.Background(), entry.ID); err == nil && u.paste != nil {
+		// The synthesized keystroke would come straight back to us while
+		// the keyboard is grabbed.
+		u.releaseGrabs(conn)
+		return u.paste.paste(conn, keymap, u.window)
+	}
+	return nil
+}
+
+// nextBoard makes the board after the current one active and shows its
+// entries.
+func (u *ui) nextBoard(daemon *smartpasta.Client) {
+	boards, err := daemon.Boards(context.Background())
+	if err != nil || len(boards) < 2 {
+		return
+	}
+	u.flushDeletes(daemon)
+	next := boards[0].Name
+	for i, info := range boards {
+		if info.Name == daemon.Board {
+			next = boards[(i+1)%len(boards)].Name
 		}
 	}
+	if err := daemon.SwitchBoard(context.Background(), next); err != nil {
+		return
+	}
+	entries, err := daemon.History(context.Background())
+	if err != nil {
+		return
+	}
+	u.state.tab = tabHistory
+	u.setEntries(entries)
+	u.boardName = next
+}
+
+func (u *ui) editSelected(conn *xgb.Conn, daemon *smartpasta.Client) error {
+	entry := u.state.entries[u.state.selectedIndex]
+	_ = xproto.UnmapWindowChecked(conn, u.window).Check()
+	u.releaseGrabs(conn)
+
+	edited, changed, err := editInTerminal(entry.Content)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+	_, err = daemon.Update(context.Background(), entry.ID, edited)
+	return err
+}
+
+// handleMenuKey processes a key press while the transform menu is open and
+// reports whether the picker should close.
+func (u *ui) handleMenuKey(keymap *keymap, ev xproto.KeyPressEvent, daemon *smartpasta.Client) (bool, error) {
+	switch {
+	case keymap.matches(ev.Detail, keysymEscape):
+		u.menu = nil
+	case keymap.matches(ev.Detail, keysymUp):
+		u.menu.cursor.move(-1, len(u.menu.items), u.state.visibleCount)
+	case keymap.matches(ev.Detail, keysymDown):
+		u.menu.cursor.move(1, len(u.menu.items), u.state.visibleCount)
+	case keymap.matches(ev.Detail, keysymReturn):
+		mode := "replace"
+		if ev.State&xproto.ModMaskShift != 0 {
+			mode = "add"
+		}
+		entry := u.state.entries[u.state.selectedIndex]
+		item := u.menu.items[u.menu.cursor.selectedIndex]
+		if _, err := daemon.Transform(context.Background(), entry.ID, item.Name, mode); err != nil {
+			u.failure = item.Label + ": " + err.Error()
+			return false, nil
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (c *listCursor) move(delta int, count int, visibleCount int) {
+	if count == 0 {
+		return
+	}
+	newIndex := c.selectedIndex + delta
+	if newIndex < 0 {
+		newIndex = 0
+	}
+	if newIndex >= count {
+		newIndex = count - 1
+	}
+	c.selectedIndex = newIndex
+
+	if newIndex < c.visibleTop {
+		c.visibleTop = newIndex
+	}
+	if newIndex >= c.visibleTop+visibleCount {
+		c.visibleTop = newIndex - visibleCount + 1
+	}
 }
 
 func (u *ui) moveSelection(delta int) {
@@ -518,7 +822,8 @@ func (u *ui) moveSelection(delta int) {
 	if count == 0 {
 		return
 	}
-	newIndex := u.state.selectedIndex + delta
+	oldIndex := u.state.selectedIndex
+	newIndex := oldIndex + delta
 	if newIndex < 0 {
 		newIndex = 0
 	}
@@ -527,6 +832,21 @@ func (u *ui) moveSelection(delta int) {
 	}
 	u.state.selectedIndex = newIndex
 
+	// Page-sized jumps scroll the view along with the selection so the
+	// highlight keeps its row where possible.
+	if delta > 1 || delta < -1 {
+		u.state.visibleTop += newIndex - oldIndex
+	}
+	maxTop := count - u.state.visibleCount
+	if maxTop < 0 {
+		maxTop = 0
+	}
+	if u.state.visibleTop > maxTop {
+		u.state.visibleTop = maxTop
+	}
+	if u.state.visibleTop < 0 {
+		u.state.visibleTop = 0
+	}
 	if newIndex < u.state.visibleTop {
 		u.state.visibleTop = newIndex
 	}
@@ -539,7 +859,22 @@ func (u *ui) draw(conn *xgb.Conn) {
 	rect := xproto.Rectangle{X: 0, Y: 0, Width: uint16(u.state.width), Height: uint16(u.state.height)}
 	_ = xproto.PolyFillRectangleChecked(conn, xproto.Drawable(u.window), u.bgGC, []xproto.Rectangle{rect}).Check()
 
-	textY := padding + u.lineHeight - 4
+	u.drawTabs(conn)
+	if u.menu != nil {
+		u.drawMenu(conn)
+		return
+	}
+	if u.prompt != nil {
+		u.drawPrompt(conn)
+		return
+	}
+	if u.state.tab == tabSnippets {
+		u.drawSnippets(conn)
+		return
+	}
+
+	u.drawSearchLine(conn)
+	textY := u.listTop() + u.baseline
 	start := u.state.visibleTop
 	end := start + u.state.visibleCount
 	if end > len(u.state.entries) {
@@ -547,57 +882,226 @@ func (u *ui) draw(conn *xgb.Conn) {
 	}
 	if len(u.state.entries) == 0 {
 		msg := "No clipboard history"
-		u.drawText(conn, padding, textY, msg, u.textGC)
+		if len(u.state.query) > 0 {
+			msg = "No matches"
+		}
+		u.drawText(conn, u.padding, textY, msg, u.textGC)
 		u.drawFooter(conn)
 		return
 	}
 
 	for i := start; i < end; i++ {
 		offset := i - start
-		y := padding + offset*u.lineHeight
+		y := u.listTop() + offset*u.lineHeight
+		gc := u.textGC
+		badgeGC := u.footerTextGC
+		matchGC := u.matchGC
 		if i == u.state.selectedIndex {
 			hRect := xproto.Rectangle{X: 0, Y: int16(y), Width: uint16(u.state.width), Height: uint16(u.lineHeight)}
 			_ = xproto.PolyFillRectangleChecked(conn, xproto.Drawable(u.window), u.highlightGC, []xproto.Rectangle{hRect}).Check()
-			u.drawText(conn, padding, y+u.lineHeight-4, previewLine(u.state.entries[i].Content), u.highlightTextGC)
-			continue
+			gc = u.highlightTextGC
+			badgeGC = u.highlightTextGC
+			matchGC = u.matchHighlightGC
+		}
+		var positions []int
+		if i < len(u.state.matchPositions) {
+			positions = u.state.matchPositions[i]
+		}
+		label := ""
+		if offset < 10 {
+			label = fmt.Sprint((offset + 1) % 10)
+		}
+		if u.state.entries[i].Pinned {
+			label += "*"
 		}
-		u.drawText(conn, padding, y+u.lineHeight-4, previewLine(u.state.entries[i].Content), u.textGC)
+		u.drawEntry(conn, y, label, u.state.entries[i], positions, gc, badgeGC, matchGC)
 	}
+	u.drawPreview(conn)
 	u.drawFooter(conn)
 }
 
+func (u *ui) drawMenu(conn *xgb.Conn) {
+	start := u.menu.cursor.visibleTop
+	end := start + u.state.visibleCount
+	if end > len(u.menu.items) {
+		end = len(u.menu.items)
+	}
+	for i := start; i < end; i++ {
+		y := u.listTop() + (i-start)*u.lineHeight
+		gc := u.textGC
+		if i == u.menu.cursor.selectedIndex {
+			hRect := xproto.Rectangle{X: 0, Y: int16(y), Width: uint16(u.state.width), Height: uint16(u.lineHeight)}
+			_ = xproto.PolyFillRectangleChecked(conn, xproto.Drawable(u.window), u.highlightGC, []xproto.Rectangle{hRect}).Check()
+			gc = u.highlightTextGC
+		}
+		u.drawText(conn, u.padding, y+u.baseline, u.menu.items[i].Label, gc)
+	}
+	u.drawHint(conn, "Enter: copy result  Shift+Enter: add as entry  Esc: back")
+}
+
+func (u *ui) drawEntry(conn *xgb.Conn, y int, label string, entry history.Entry, positions []int, gc xproto.Gcontext, badgeGC xproto.Gcontext, matchGC xproto.Gcontext) {
+	baseline := y + u.baseline
+	u.drawText(conn, u.padding, baseline, label, badgeGC)
+	if entry.Sensitive {
+		u.drawText(conn, u.padding+u.indexWidth, baseline, "SECRET", badgeGC)
+		u.drawText(conn, u.padding+u.indexWidth+u.badgeWidth, baseline, sensitiveMask, gc)
+		return
+	}
+	u.drawText(conn, u.padding+u.indexWidth, baseline, kindBadge(entry.Kind), badgeGC)
+
+	textX := u.padding + u.indexWidth + u.badgeWidth
+	if entry.Kind == classify.KindColor {
+		if swatch, ok := u.swatchGC(conn, entry.Meta["hex"]); ok {
+			top := y + (u.lineHeight-u.swatchSize)/2
+			rect := xproto.Rectangle{X: int16(textX), Y: int16(top), Width: uint16(u.swatchSize), Height: uint16(u.swatchSize)}
+			_ = xproto.PolyFillRectangleChecked(conn, xproto.Drawable(u.window), swatch, []xproto.Rectangle{rect}).Check()
+			textX += u.swatchSize + 6
+		}
+	}
+	u.drawText(conn, textX, baseline, previewLine(entry.Content), gc)
+	u.drawMatches(conn, textX, baseline, entry.Content, positions, matchGC)
+}
+
+func (u *ui) swatchGC(conn *xgb.Conn, hex string) (xproto.Gcontext, bool) {
+	if gc, ok := u.swatchGCs[hex]; ok {
+		return gc, gc != 0
+	}
+	pixel, err := allocColor(conn, u.colormap, hex)
+	if err != nil {
+		u.swatchGCs[hex] = 0
+		return 0, false
+	}
+	gc, err := createGC(conn, u.window, pixel, pixel, 0)
+	if err != nil {
+		u.swatchGCs[hex] = 0
+		return 0, false
+	}
+	u.swatchGCs[hex] = gc
+	return gc, true
+}
+
+func (u *ui) searchTop() int {
+	if len(u.state.snippets) > 0 {
+		return u.padding + u.lineHeight
+	}
+	return u.padding
+}
+
+func (u *ui) listTop() int {
+	return u.searchTop() + u.lineHeight
+}
+
+func (u *ui) drawTabs(conn *xgb.Conn) {
+	if len(u.state.snippets) == 0 {
+		return
+	}
+	labels := []string{" History ", " Snippets "}
+	x := u.padding
+	for i, label := range labels {
+		gc := u.footerTextGC
+		if i == u.state.tab {
+			label = "[" + label[1:len(label)-1] + "]"
+			gc = u.textGC
+		}
+		u.drawText(conn, x, u.padding+u.baseline-2, label, gc)
+		x += u.text.width(label + "  ")
+	}
+}
+
 func (u *ui) drawFooter(conn *xgb.Conn) {
-	footerY := u.state.height - padding
-	u.drawText(conn, padding, footerY, u.footerText, u.footerTextGC)
+	footer := u.footerText
+	if u.confirmClear {
+		footer = "Clear all unpinned entries? y: yes  any other key: cancel"
+		if !u.showFooter {
+			// Without a footer the question replaces the search line.
+			top := u.searchTop()
+			rect := xproto.Rectangle{X: 0, Y: int16(top), Width: uint16(u.state.width), Height: uint16(u.lineHeight)}
+			_ = xproto.PolyFillRectangleChecked(conn, xproto.Drawable(u.window), u.bgGC, []xproto.Rectangle{rect}).Check()
+			u.drawText(conn, u.padding, top+u.baseline, footer, u.matchGC)
+			return
+		}
+	}
+	if u.boardName != "" && u.boardName != history.DefaultBoard {
+		footer = "[" + u.boardName + "]  " + footer
+	}
+	u.drawHint(conn, footer)
 }
 
-func (u *ui) drawText(conn *xgb.Conn, x int, y int, text string, gc xproto.Gcontext) {
-	if text == "" {
+// drawHint draws text in the footer line unless the footer is hidden. A
+// failure replaces the hint; without a footer it goes in the search line.
+func (u *ui) drawHint(conn *xgb.Conn, text string) {
+	if u.failure != "" {
+		if !u.showFooter {
+			top := u.searchTop()
+			rect := xproto.Rectangle{X: 0, Y: int16(top), Width: uint16(u.state.width), Height: uint16(u.lineHeight)}
+			_ = xproto.PolyFillRectangleChecked(conn, xproto.Drawable(u.window), u.bgGC, []xproto.Rectangle{rect}).Check()
+			u.drawText(conn, u.padding, top+u.baseline, u.failure, u.matchGC)
+			return
+		}
+		u.drawText(conn, u.padding, u.state.height-u.padding, u.failure, u.matchGC)
 		return
 	}
-	bytes := []byte(text)
-	if len(bytes) > 255 {
-		bytes = bytes[:255]
+	if !u.showFooter {
+		return
 	}
-	_ = xproto.ImageText8Checked(conn, uint8(len(bytes)), xproto.Drawable(u.window), gc, int16(x), int16(y), string(bytes)).Check()
+	u.drawText(conn, u.padding, u.state.height-u.padding, text, u.footerTextGC)
 }
 
-func previewLine(content string) string {
-	line := strings.ReplaceAll(content, "\n", " ")
-	line = strings.TrimSpace(line)
-	return ellipsize(line, maxPreviewChars)
+// drawText draws text at x, ellipsized to the window's right padding.
+func (u *ui) drawText(conn *xgb.Conn, x int, y int, text string, gc xproto.Gcontext) {
+	u.drawTextWidth(conn, x, y, text, gc, u.state.width-u.padding-x)
 }
 
-func ellipsize(text string, max int) string {
-	if max <= 0 {
-		return ""
+func (u *ui) drawTextWidth(conn *xgb.Conn, x int, y int, text string, gc xproto.Gcontext, maxWidth int) {
+	if text == "" || maxWidth <= 0 {
+		return
 	}
-	runes := []rune(text)
-	if len(runes) <= max {
-		return text
+	fitted, _ := u.text.fit(text, maxWidth)
+	u.text.draw(conn, xproto.Drawable(u.window), gc, x, y, fitted)
+}
+
+// sensitiveMask is shown in place of a sensitive entry's content.
+const sensitiveMask = "********"
+
+func kindBadge(kind string) string {
+	switch kind {
+	case classify.KindURL:
+		return "URL"
+	case classify.KindPath:
+		return "PATH"
+	case classify.KindJSON:
+		return "JSON"
+	case classify.KindEmail:
+		return "MAIL"
+	case classify.KindColor:
+		return "COLOR"
+	case classify.KindNumber:
+		return "NUM"
+	case classify.KindCode:
+		return "CODE"
+	default:
+		return ""
 	}
-	if max <= 3 {
-		return string(runes[:max])
+}
+
+// flattenLine replaces line breaks and tabs with single spaces, keeping byte
+// offsets intact.
+func flattenLine(content string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == '\t' {
+			return ' '
+		}
+		return r
+	}, content)
+}
+
+// previewLine flattens content to a single line. It is cut to
+// maxPreviewRunes only to bound the work; the final ellipsizing is done by
+// pixel width when drawing.
+func previewLine(content string) string {
+	line := strings.TrimSpace(flattenLine(content))
+	if utf8.RuneCountInString(line) <= maxPreviewRunes {
+		return line
 	}
-	return string(runes[:max-3]) + "..."
+	return string([]rune(line)[:maxPreviewRunes])
 }
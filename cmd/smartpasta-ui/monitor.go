@@ -0,0 +1,107 @@
+package main
+
+import (
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/xinerama"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+type rect struct {
+	x      int
+	y      int
+	width  int
+	height int
+}
+
+func (r rect) contains(x int, y int) bool {
+	return x >= r.x && x < r.x+r.width && y >= r.y && y < r.y+r.height
+}
+
+func (r rect) intersect(o rect) rect {
+	x1, y1 := max(r.x, o.x), max(r.y, o.y)
+	x2, y2 := min(r.x+r.width, o.x+o.width), min(r.y+r.height, o.y+o.height)
+	if x2 <= x1 || y2 <= y1 {
+		return rect{}
+	}
+	return rect{x: x1, y: y1, width: x2 - x1, height: y2 - y1}
+}
+
+func (r rect) empty() bool {
+	return r.width <= 0 || r.height <= 0
+}
+
+// pickerBounds returns the area the picker may occupy: the monitor under the
+// pointer, reduced to the desktop work area so panels stay uncovered.
+func pickerBounds(conn *xgb.Conn, screen *xproto.ScreenInfo, pointerX int, pointerY int) rect {
+	bounds := rect{width: int(screen.WidthInPixels), height: int(screen.HeightInPixels)}
+	for _, monitor := range monitors(conn, screen.Root) {
+		if monitor.contains(pointerX, pointerY) {
+			bounds = monitor
+			break
+		}
+	}
+	if workarea, ok := workArea(conn, screen.Root); ok {
+		if clipped := bounds.intersect(workarea); !clipped.empty() {
+			bounds = clipped
+		}
+	}
+	return bounds
+}
+
+// monitors lists monitor geometry from RandR, falling back to Xinerama.
+func monitors(conn *xgb.Conn, root xproto.Window) []rect {
+	if err := randr.Init(conn); err == nil {
+		if resources, err := randr.GetScreenResourcesCurrent(conn, root).Reply(); err == nil {
+			var rects []rect
+			for _, crtc := range resources.Crtcs {
+				info, err := randr.GetCrtcInfo(conn, crtc, resources.ConfigTimestamp).Reply()
+				if err != nil || info.Mode == 0 || info.Width == 0 || info.Height == 0 {
+					continue
+				}
+				rects = append(rects, rect{x: int(info.X), y: int(info.Y), width: int(info.Width), height: int(info.Height)})
+			}
+			if len(rects) > 0 {
+				return rects
+			}
+		}
+	}
+
+	if err := xinerama.Init(conn); err == nil {
+		if reply, err := xinerama.QueryScreens(conn).Reply(); err == nil {
+			rects := make([]rect, 0, len(reply.ScreenInfo))
+			for _, info := range reply.ScreenInfo {
+				rects = append(rects, rect{x: int(info.XOrg), y: int(info.YOrg), width: int(info.Width), height: int(info.Height)})
+			}
+			return rects
+		}
+	}
+	return nil
+}
+
+// workArea reads _NET_WORKAREA for the current desktop.
+func workArea(conn *xgb.Conn, root xproto.Window) (rect, bool) {
+	desktop := 0
+	if atom, err := internAtom(conn, "_NET_CURRENT_DESKTOP"); err == nil {
+		reply, err := xproto.GetProperty(conn, false, root, atom, xproto.AtomCardinal, 0, 1).Reply()
+		if err == nil && reply.Format == 32 && len(reply.Value) >= 4 {
+			desktop = int(xgb.Get32(reply.Value))
+		}
+	}
+
+	atom, err := internAtom(conn, "_NET_WORKAREA")
+	if err != nil {
+		return rect{}, false
+	}
+	reply, err := xproto.GetProperty(conn, false, root, atom, xproto.AtomCardinal, uint32(desktop*4), 4).Reply()
+	if err != nil || reply.Format != 32 || len(reply.Value) < 16 {
+		return rect{}, false
+	}
+	area := rect{
+		x:      int(int32(xgb.Get32(reply.Value[0:]))),
+		y:      int(int32(xgb.Get32(reply.Value[4:]))),
+		width:  int(xgb.Get32(reply.Value[8:])),
+		height: int(xgb.Get32(reply.Value[12:])),
+	}
+	return area, !area.empty()
+}
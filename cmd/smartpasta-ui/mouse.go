@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+const (
+	buttonLeft      xproto.Button = 1
+	buttonWheelUp   xproto.Button = 4
+	buttonWheelDown xproto.Button = 5
+)
+
+// grabPointer routes all pointer events to the picker so a click outside it
+// can close it.
+func (u *ui) grabPointer(conn *xgb.Conn) error {
+	mask := uint16(xproto.EventMaskButtonPress | xproto.EventMaskPointerMotion)
+	reply, err := xproto.GrabPointer(
+		conn,
+		true,
+		u.window,
+		mask,
+		xproto.GrabModeAsync,
+		xproto.GrabModeAsync,
+		xproto.WindowNone,
+		xproto.CursorNone,
+		xproto.TimeCurrentTime,
+	).Reply()
+	if err != nil {
+		return err
+	}
+	if reply.Status != xproto.GrabStatusSuccess {
+		return fmt.Errorf("grab pointer: status %d", reply.Status)
+	}
+	return nil
+}
+
+// handleButton processes a button press and reports whether the picker
+// should close and, for a left click on an entry, its index (-1 otherwise).
+func (u *ui) handleButton(ev xproto.ButtonPressEvent) (bool, int) {
+	x, y := int(ev.EventX), int(ev.EventY)
+	if x < 0 || y < 0 || x >= u.state.width || y >= u.state.height {
+		return true, -1
+	}
+	if u.menu != nil || u.prompt != nil || u.state.tab != tabHistory {
+		return false, -1
+	}
+
+	switch ev.Detail {
+	case buttonWheelUp:
+		u.moveSelection(-1)
+	case buttonWheelDown:
+		u.moveSelection(1)
+	case buttonLeft:
+		if index := u.rowAt(y); index >= 0 {
+			return false, index
+		}
+	}
+	return false, -1
+}
+
+// handleMotion highlights the entry under the pointer and reports whether
+// the highlight changed.
+func (u *ui) handleMotion(ev xproto.MotionNotifyEvent) bool {
+	if u.menu != nil || u.prompt != nil || u.state.tab != tabHistory {
+		return false
+	}
+	index := u.rowAt(int(ev.EventY))
+	if index < 0 || index == u.state.selectedIndex {
+		return false
+	}
+	u.state.selectedIndex = index
+	return true
+}
+
+// rowAt maps a window y coordinate to the index of the visible entry drawn
+// there, or -1.
+func (u *ui) rowAt(y int) int {
+	if !u.selectionEnabled || y < u.listTop() {
+		return -1
+	}
+	row := (y - u.listTop()) / u.lineHeight
+	if row >= u.state.visibleCount {
+		return -1
+	}
+	index := u.state.visibleTop + row
+	if index >= len(u.state.entries) {
+		return -1
+	}
+	return index
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+const (
+	keysymHome     xproto.Keysym = 0xff50
+	keysymPageUp   xproto.Keysym = 0xff55
+	keysymPageDown xproto.Keysym = 0xff56
+	keysymEnd      xproto.Keysym = 0xff57
+)
+
+// handleNavigationKey moves the highlight for arrow, page and Vim-style keys.
+// It reports whether the key was consumed and, for digit quick-select, the
+// index of the entry to select (-1 otherwise). Printable navigation keys
+// only apply while no filter is being typed.
+func (u *ui) handleNavigationKey(keymap *keymap, ev xproto.KeyPressEvent, pendingG bool) (bool, int) {
+	page := u.state.visibleCount
+	half := page / 2
+	if half < 1 {
+		half = 1
+	}
+	count := len(u.state.entries)
+
+	switch {
+	case keymap.matches(ev.Detail, keysymUp):
+		u.moveSelection(-1)
+		return true, -1
+	case keymap.matches(ev.Detail, keysymDown):
+		u.moveSelection(1)
+		return true, -1
+	case keymap.matches(ev.Detail, keysymPageUp):
+		u.moveSelection(-page)
+		return true, -1
+	case keymap.matches(ev.Detail, keysymPageDown):
+		u.moveSelection(page)
+		return true, -1
+	case keymap.matches(ev.Detail, keysymHome):
+		u.moveSelection(-count)
+		return true, -1
+	case keymap.matches(ev.Detail, keysymEnd):
+		u.moveSelection(count)
+		return true, -1
+	}
+
+	r, printable := keysymRune(keymap.lookup(ev.Detail, ev.State))
+	if !printable {
+		return false, -1
+	}
+	if ev.State&xproto.ModMaskControl != 0 {
+		switch r {
+		case 'u', 'U':
+			u.moveSelection(-half)
+			return true, -1
+		case 'd', 'D':
+			u.moveSelection(half)
+			return true, -1
+		}
+		return false, -1
+	}
+	if u.state.filtering || ev.State&xproto.ModMask1 != 0 {
+		return false, -1
+	}
+
+	switch {
+	case r == 'j':
+		u.moveSelection(1)
+	case r == 'k':
+		u.moveSelection(-1)
+	case r == 'G':
+		u.moveSelection(count)
+	case r == 'g':
+		if pendingG {
+			u.moveSelection(-count)
+		} else {
+			u.pendingG = true
+		}
+	case r >= '0' && r <= '9':
+		// Rows are labelled 1-9 then 0 for the tenth visible entry.
+		row := int(r-'0') - 1
+		if r == '0' {
+			row = 9
+		}
+		index := u.state.visibleTop + row
+		if row >= u.state.visibleCount || index >= count {
+			return true, -1
+		}
+		return true, index
+	default:
+		return false, -1
+	}
+	return true, -1
+}
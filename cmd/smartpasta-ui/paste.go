@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgb/xtest"
+
+	"github.com/triiberg/smartpasta/internal/config"
+)
+
+const (
+	keysymInsert   xproto.Keysym = 0xff63
+	keysymShiftL   xproto.Keysym = 0xffe1
+	keysymControlL xproto.Keysym = 0xffe3
+	keysymAltL     xproto.Keysym = 0xffe9
+	keysymSuperL   xproto.Keysym = 0xffeb
+
+	focusSettleDelay = 60 * time.Millisecond
+)
+
+// pasteTarget is the window that had focus before the picker opened. After a
+// selection the picker hands focus back and synthesizes the paste keystroke
+// through XTEST.
+type pasteTarget struct {
+	window xproto.Window
+	class  string
+	keys   []xproto.Keysym
+}
+
+// newPasteTarget remembers the focused window and resolves the paste keys
+// for its WM_CLASS. It returns nil when auto-paste is disabled for it.
+func newPasteTarget(conn *xgb.Conn, cfg config.PasteConfig) (*pasteTarget, error) {
+	if err := xtest.Init(conn); err != nil {
+		return nil, fmt.Errorf("XTEST extension unavailable: %w", err)
+	}
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+
+	window := activeWindow(conn, root)
+	if window == 0 || window == root {
+		return nil, nil
+	}
+	class := windowClass(conn, window)
+
+	spec := cfg.Keys
+	for _, terminal := range cfg.Terminals {
+		if class == terminal {
+			spec = cfg.TerminalKeys
+		}
+	}
+	if override, ok := cfg.Apps[class]; ok {
+		spec = override
+	}
+	if spec == "off" || spec == "" {
+		return nil, nil
+	}
+	keys, err := parseKeys(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &pasteTarget{window: window, class: class, keys: keys}, nil
+}
+
+// paste closes the picker, focuses the target window and sends the paste
+// keystroke to it.
+func (p *pasteTarget) paste(conn *xgb.Conn, keymap *keymap, picker xproto.Window) error {
+	_ = xproto.UnmapWindowChecked(conn, picker).Check()
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+
+	if atom, err := internAtom(conn, "_NET_ACTIVE_WINDOW"); err == nil {
+		// Source indication 2 marks the request as coming from a pager-like
+		// tool so window managers honour it.
+		data := xproto.ClientMessageDataUnionData32New([]uint32{2, uint32(xproto.TimeCurrentTime), 0, 0, 0})
+		event := xproto.ClientMessageEvent{Format: 32, Window: p.window, Type: atom, Data: data}
+		mask := uint32(xproto.EventMaskSubstructureRedirect | xproto.EventMaskSubstructureNotify)
+		_ = xproto.SendEventChecked(conn, false, root, mask, string(event.Bytes())).Check()
+	}
+	_ = xproto.SetInputFocusChecked(conn, xproto.InputFocusParent, p.window, xproto.TimeCurrentTime).Check()
+	time.Sleep(focusSettleDelay)
+
+	codes := make([]xproto.Keycode, 0, len(p.keys))
+	for _, sym := range p.keys {
+		code, ok := keymap.keycode(sym)
+		if !ok {
+			return fmt.Errorf("no keycode for keysym 0x%x", sym)
+		}
+		codes = append(codes, code)
+	}
+	for _, code := range codes {
+		if err := xtest.FakeInputChecked(conn, xproto.KeyPress, byte(code), 0, root, 0, 0, 0).Check(); err != nil {
+			return err
+		}
+	}
+	for i := len(codes) - 1; i >= 0; i-- {
+		if err := xtest.FakeInputChecked(conn, xproto.KeyRelease, byte(codes[i]), 0, root, 0, 0, 0).Check(); err != nil {
+			return err
+		}
+	}
+	conn.Sync()
+	return nil
+}
+
+func activeWindow(conn *xgb.Conn, root xproto.Window) xproto.Window {
+	if atom, err := internAtom(conn, "_NET_ACTIVE_WINDOW"); err == nil {
+		reply, err := xproto.GetProperty(conn, false, root, atom, xproto.AtomWindow, 0, 1).Reply()
+		if err == nil && reply.Format == 32 && len(reply.Value) >= 4 {
+			if window := xproto.Window(xgb.Get32(reply.Value)); window != 0 {
+				return window
+			}
+		}
+	}
+	focus, err := xproto.GetInputFocus(conn).Reply()
+	if err != nil {
+		return 0
+	}
+	return focus.Focus
+}
+
+// windowClass returns the lower-case WM_CLASS class name of window or its
+// nearest ancestor that has one.
+func windowClass(conn *xgb.Conn, window xproto.Window) string {
+	for window != 0 {
+		reply, err := xproto.GetProperty(conn, false, window, xproto.AtomWmClass, xproto.AtomString, 0, 256).Reply()
+		if err == nil && len(reply.Value) > 0 {
+			parts := strings.Split(strings.TrimRight(string(reply.Value), "\x00"), "\x00")
+			return strings.ToLower(parts[len(parts)-1])
+		}
+		tree, err := xproto.QueryTree(conn, window).Reply()
+		if err != nil || tree.Parent == tree.Root {
+			return ""
+		}
+		window = tree.Parent
+	}
+	return ""
+}
+
+// parseKeys turns a spec like "ctrl+shift+v" into keysyms, modifiers first.
+func parseKeys(spec string) ([]xproto.Keysym, error) {
+	var keys []xproto.Keysym
+	for _, name := range strings.Split(strings.ToLower(spec), "+") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "ctrl", "control":
+			keys = append(keys, keysymControlL)
+		case "shift":
+			keys = append(keys, keysymShiftL)
+		case "alt":
+			keys = append(keys, keysymAltL)
+		case "super", "win":
+			keys = append(keys, keysymSuperL)
+		case "insert":
+			keys = append(keys, keysymInsert)
+		default:
+			if len(name) != 1 || name[0] < 0x20 || name[0] > 0x7e {
+				return nil, fmt.Errorf("invalid key %q", name)
+			}
+			keys = append(keys, xproto.Keysym(name[0]))
+		}
+	}
+	return keys, nil
+}
+
+func internAtom(conn *xgb.Conn, name string) (xproto.Atom, error) {
+	reply, err := xproto.InternAtom(conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, err
+	}
+	return reply.Atom, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/triiberg/smartpasta/internal/history"
+)
+
+const (
+	keysymTab xproto.Keysym = 0xff09
+
+	previewMaxLines = 12
+	previewMinLines = 3
+	// previewMaxBytes bounds how much of an entry is prepared for wrapping.
+	previewMaxBytes = 16 << 10
+)
+
+// togglePreview shows or hides the preview pane below the list, growing or
+// shrinking the window within the monitor bounds. When there is not enough
+// room the list gives up rows to the pane.
+func (u *ui) togglePreview(conn *xgb.Conn) {
+	if u.previewLines > 0 {
+		u.state.visibleCount = u.listRows
+		u.previewLines = 0
+	} else {
+		u.listRows = u.state.visibleCount
+		lines := previewMaxLines
+		room := (u.bounds.height-u.state.height-u.padding)/u.lineHeight - 1
+		if room < lines {
+			lines = room
+		}
+		if lines < previewMinLines {
+			lines = previewMinLines
+			take := lines - room
+			if take > u.state.visibleCount-1 {
+				take = u.state.visibleCount - 1
+			}
+			u.state.visibleCount -= take
+		}
+		u.previewLines = lines
+	}
+	u.moveSelection(0)
+	u.resize(conn)
+}
+
+// resize recomputes the window height for the current list and preview
+// sizes and moves the window up when it would leave the bounds.
+func (u *ui) resize(conn *xgb.Conn) {
+	height := u.listTop() + u.state.visibleCount*u.lineHeight + u.padding + u.footerHeight
+	if u.previewLines > 0 {
+		height += u.padding + (u.previewLines+1)*u.lineHeight
+	}
+	if height > u.bounds.height {
+		height = u.bounds.height
+	}
+	y := u.originY
+	if y+height > u.bounds.y+u.bounds.height {
+		y = u.bounds.y + u.bounds.height - height
+	}
+	if y < u.bounds.y {
+		y = u.bounds.y
+	}
+	u.state.height = height
+	_ = xproto.ConfigureWindowChecked(conn, u.window,
+		xproto.ConfigWindowY|xproto.ConfigWindowHeight,
+		[]uint32{uint32(int32(y)), uint32(height)}).Check()
+}
+
+// drawPreview renders the highlighted entry below the list: a summary line
+// followed by the content wrapped over several lines with whitespace made
+// visible.
+func (u *ui) drawPreview(conn *xgb.Conn) {
+	if u.previewLines == 0 || !u.selectionEnabled || len(u.state.entries) == 0 {
+		return
+	}
+	entry := u.state.entries[u.state.selectedIndex]
+	top := u.listTop() + u.state.visibleCount*u.lineHeight + u.padding/2
+	_ = xproto.PolyLineChecked(conn, xproto.CoordModeOrigin, xproto.Drawable(u.window), u.footerTextGC, []xproto.Point{
+		{X: int16(u.padding), Y: int16(top)},
+		{X: int16(u.state.width - u.padding), Y: int16(top)},
+	}).Check()
+	top += u.padding / 2
+
+	u.drawText(conn, u.padding, top+u.baseline, previewSummary(entry), u.footerTextGC)
+	if entry.Sensitive {
+		u.drawText(conn, u.padding, top+u.lineHeight+u.baseline, sensitiveMask, u.textGC)
+		return
+	}
+	content := entry.Content
+	if len(content) > previewMaxBytes {
+		content = strings.ToValidUTF8(content[:previewMaxBytes], "")
+	}
+	lines := u.text.wrap(showWhitespace(content), u.state.width-2*u.padding, u.previewLines)
+	for i, line := range lines {
+		u.drawText(conn, u.padding, top+(i+1)*u.lineHeight+u.baseline, line, u.textGC)
+	}
+}
+
+func previewSummary(entry history.Entry) string {
+	content := entry.Content
+	lines := strings.Count(strings.TrimSuffix(content, "\n"), "\n") + 1
+	summary := fmt.Sprintf("%d chars, %d bytes, %d lines  created %s", utf8.RuneCountInString(content), len(content), lines, entry.CreatedAt.Format("2006-01-02 15:04:05"))
+	if entry.EditedAt != nil {
+		summary += "  edited " + entry.EditedAt.Format("15:04:05")
+	}
+	if entry.Source != "" {
+		summary += "  from " + entry.Source
+	}
+	return summary
+}
+
+// showWhitespace replaces spaces, tabs and carriage returns with visible
+// markers and ends every line with a pilcrow. The markers are Latin-1 so
+// they render with the fallback font too.
+func showWhitespace(content string) string {
+	return strings.NewReplacer(" ", "·", "\t", "»", "\r", "¤", "\n", "¶\n").Replace(content)
+}
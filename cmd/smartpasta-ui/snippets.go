@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/triiberg/smartpasta/internal/snippet"
+	"github.com/triiberg/smartpasta/pkg/smartpasta"
+)
+
+// snippetPrompt collects values for a snippet's {{input:...}} fields before
+// the daemon expands it.
+type snippetPrompt struct {
+	snippet    snippet.Snippet
+	fieldIndex int
+	values     map[string]string
+	input      []rune
+}
+
+func (u *ui) handleSnippetKey(keymap *keymap, ev xproto.KeyPressEvent, daemon *smartpasta.Client) (bool, error) {
+	switch {
+	case keymap.matches(ev.Detail, keysymUp):
+		u.state.snippetCursor.move(-1, len(u.state.snippets), u.state.visibleCount)
+	case keymap.matches(ev.Detail, keysymDown):
+		u.state.snippetCursor.move(1, len(u.state.snippets), u.state.visibleCount)
+	case keymap.matches(ev.Detail, keysymReturn):
+		item := u.state.snippets[u.state.snippetCursor.selectedIndex]
+		if len(item.Fields) == 0 {
+			if _, err := daemon.ExpandSnippet(context.Background(), item.Name, nil); err != nil {
+				u.failure = item.Name + ": " + err.Error()
+				return false, nil
+			}
+			return true, nil
+		}
+		u.prompt = &snippetPrompt{snippet: item, values: make(map[string]string)}
+	case ev.State&xproto.ModMask1 != 0 && keymap.matches(ev.Detail, keysymD, keysymd):
+		_ = daemon.Dump(context.Background())
+		return true, nil
+	}
+	return false, nil
+}
+
+func (u *ui) handlePromptKey(keymap *keymap, ev xproto.KeyPressEvent, daemon *smartpasta.Client) (bool, error) {
+	p := u.prompt
+	switch {
+	case keymap.matches(ev.Detail, keysymEscape):
+		u.prompt = nil
+	case keymap.matches(ev.Detail, keysymReturn):
+		p.values[p.snippet.Fields[p.fieldIndex]] = string(p.input)
+		p.input = nil
+		p.fieldIndex++
+		if p.fieldIndex == len(p.snippet.Fields) {
+			if _, err := daemon.ExpandSnippet(context.Background(), p.snippet.Name, p.values); err != nil {
+				// Back to the snippet list, where the failure is shown.
+				u.prompt = nil
+				u.failure = p.snippet.Name + ": " + err.Error()
+				return false, nil
+			}
+			return true, nil
+		}
+	case keymap.matches(ev.Detail, keysymBack):
+		if len(p.input) > 0 {
+			p.input = p.input[:len(p.input)-1]
+		}
+	default:
+		if r, ok := keysymRune(keymap.lookup(ev.Detail, ev.State)); ok {
+			p.input = append(p.input, r)
+		}
+	}
+	return false, nil
+}
+
+func (u *ui) drawSnippets(conn *xgb.Conn) {
+	cursor := u.state.snippetCursor
+	start := cursor.visibleTop
+	end := start + u.state.visibleCount
+	if end > len(u.state.snippets) {
+		end = len(u.state.snippets)
+	}
+	for i := start; i < end; i++ {
+		y := u.listTop() + (i-start)*u.lineHeight
+		gc := u.textGC
+		nameGC := u.footerTextGC
+		if i == cursor.selectedIndex {
+			hRect := xproto.Rectangle{X: 0, Y: int16(y), Width: uint16(u.state.width), Height: uint16(u.lineHeight)}
+			_ = xproto.PolyFillRectangleChecked(conn, xproto.Drawable(u.window), u.highlightGC, []xproto.Rectangle{hRect}).Check()
+			gc = u.highlightTextGC
+			nameGC = u.highlightTextGC
+		}
+		item := u.state.snippets[i]
+		baseline := y + u.baseline
+		u.drawTextWidth(conn, u.padding, baseline, item.Name, nameGC, u.snippetNameWidth-6)
+		u.drawText(conn, u.padding+u.snippetNameWidth, baseline, previewLine(item.Content), gc)
+	}
+	u.drawHint(conn, "Enter: paste snippet  Left/Right: switch tab  Esc: close")
+}
+
+func (u *ui) drawPrompt(conn *xgb.Conn) {
+	p := u.prompt
+	top := u.listTop()
+	hRect := xproto.Rectangle{X: 0, Y: int16(top), Width: uint16(u.state.width), Height: uint16(u.lineHeight)}
+	_ = xproto.PolyFillRectangleChecked(conn, xproto.Drawable(u.window), u.highlightGC, []xproto.Rectangle{hRect}).Check()
+	field := p.snippet.Fields[p.fieldIndex]
+	u.drawText(conn, u.padding, top+u.baseline, field+": "+string(p.input)+"_", u.highlightTextGC)
+
+	// Earlier answers are listed below the active field when there is room.
+	for i := 0; i < p.fieldIndex && i+1 < u.state.visibleCount; i++ {
+		y := top + (i+1)*u.lineHeight
+		previous := p.snippet.Fields[i]
+		u.drawText(conn, u.padding, y+u.baseline, previous+": "+p.values[previous], u.textGC)
+	}
+
+	footer := fmt.Sprintf("%s %d/%d  Enter: next field  Esc: cancel", p.snippet.Name, p.fieldIndex+1, len(p.snippet.Fields))
+	u.drawHint(conn, footer)
+}
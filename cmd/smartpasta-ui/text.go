@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+const (
+	unicodeFontName  = "-misc-fixed-medium-r-semicondensed--13-120-75-75-c-60-iso10646-1"
+	fallbackFontName = "fixed"
+	maxPreviewRunes  = 512
+	maxTextChunk     = 255
+)
+
+// textRenderer draws UTF-8 text with a core X font. With an ISO10646 font
+// text is sent as UCS-2 through ImageText16; with the fallback font it is
+// reduced to Latin-1 for ImageText8.
+type textRenderer struct {
+	font         xproto.Font
+	unicode      bool
+	defaultWidth int
+	ascent       int
+	descent      int
+	minByte1     int
+	maxByte1     int
+	minChar2     int
+	maxChar2     int
+	widths       []int
+	ellipsis     string
+}
+
+func newTextRenderer(conn *xgb.Conn, names ...string) (*textRenderer, error) {
+	for _, name := range names {
+		font, err := xproto.NewFontId(conn)
+		if err != nil {
+			return nil, err
+		}
+		if err := xproto.OpenFontChecked(conn, font, uint16(len(name)), name).Check(); err != nil {
+			continue
+		}
+		info, err := xproto.QueryFont(conn, xproto.Fontable(font)).Reply()
+		if err != nil {
+			_ = xproto.CloseFontChecked(conn, font).Check()
+			continue
+		}
+		t := &textRenderer{
+			font:         font,
+			unicode:      strings.HasSuffix(strings.ToLower(name), "iso10646-1"),
+			defaultWidth: int(info.MaxBounds.CharacterWidth),
+			ascent:       int(info.FontAscent),
+			descent:      int(info.FontDescent),
+			minByte1:     int(info.MinByte1),
+			maxByte1:     int(info.MaxByte1),
+			minChar2:     int(info.MinCharOrByte2),
+			maxChar2:     int(info.MaxCharOrByte2),
+		}
+		if len(info.CharInfos) > 0 {
+			t.widths = make([]int, len(info.CharInfos))
+			for i, ci := range info.CharInfos {
+				t.widths[i] = int(ci.CharacterWidth)
+			}
+		}
+		t.ellipsis = "..."
+		if t.unicode && t.hasGlyph('…') {
+			t.ellipsis = "…"
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("open font: none of %v available", names)
+}
+
+// glyph maps r to the character actually sent to the server.
+func (t *textRenderer) glyph(r rune) rune {
+	switch {
+	case r == '\t':
+		return ' '
+	case r < 0x20 || r == utf8.RuneError:
+		return '?'
+	case !t.unicode && r > 0xff:
+		return '?'
+	case r > 0xffff:
+		return 0xfffd
+	}
+	return r
+}
+
+func (t *textRenderer) index(r rune) int {
+	b1 := int(r >> 8)
+	b2 := int(r & 0xff)
+	if t.maxByte1 == 0 {
+		b1, b2 = 0, int(r)
+	}
+	if b1 < t.minByte1 || b1 > t.maxByte1 || b2 < t.minChar2 || b2 > t.maxChar2 {
+		return -1
+	}
+	return (b1-t.minByte1)*(t.maxChar2-t.minChar2+1) + (b2 - t.minChar2)
+}
+
+func (t *textRenderer) hasGlyph(r rune) bool {
+	idx := t.index(r)
+	if idx < 0 {
+		return false
+	}
+	return t.widths == nil || (idx < len(t.widths) && t.widths[idx] > 0)
+}
+
+func (t *textRenderer) runeWidth(r rune) int {
+	r = t.glyph(r)
+	if t.widths == nil {
+		return t.defaultWidth
+	}
+	idx := t.index(r)
+	if idx < 0 || idx >= len(t.widths) || t.widths[idx] == 0 {
+		return t.defaultWidth
+	}
+	return t.widths[idx]
+}
+
+func (t *textRenderer) width(text string) int {
+	width := 0
+	for _, r := range text {
+		width += t.runeWidth(r)
+	}
+	return width
+}
+
+// fit shortens text to maxWidth pixels, appending an ellipsis when it had
+// to cut. It also returns how many bytes of text are shown.
+func (t *textRenderer) fit(text string, maxWidth int) (string, int) {
+	if t.width(text) <= maxWidth {
+		return text, len(text)
+	}
+	limit := maxWidth - t.width(t.ellipsis)
+	width := 0
+	for i, r := range text {
+		w := t.runeWidth(r)
+		if width+w > limit {
+			return text[:i] + t.ellipsis, i
+		}
+		width += w
+	}
+	return text, len(text)
+}
+
+func (t *textRenderer) draw(conn *xgb.Conn, drawable xproto.Drawable, gc xproto.Gcontext, x int, y int, text string) {
+	runes := []rune(text)
+	for len(runes) > 0 {
+		chunk := runes
+		if len(chunk) > maxTextChunk {
+			chunk = chunk[:maxTextChunk]
+		}
+		runes = runes[len(chunk):]
+
+		if t.unicode {
+			chars := make([]xproto.Char2b, len(chunk))
+			for i, r := range chunk {
+				r = t.glyph(r)
+				chars[i] = xproto.Char2b{Byte1: byte(r >> 8), Byte2: byte(r)}
+			}
+			_ = xproto.ImageText16Checked(conn, byte(len(chars)), drawable, gc, int16(x), int16(y), chars).Check()
+		} else {
+			bytes := make([]byte, len(chunk))
+			for i, r := range chunk {
+				bytes[i] = byte(t.glyph(r))
+			}
+			_ = xproto.ImageText8Checked(conn, byte(len(bytes)), drawable, gc, int16(x), int16(y), string(bytes)).Check()
+		}
+		x += t.width(string(chunk))
+	}
+}
+
+// wrap breaks text into lines no wider than maxWidth pixels, honouring
+// embedded newlines. At most maxLines lines are returned; the last one is
+// ellipsized when text was cut.
+func (t *textRenderer) wrap(text string, maxWidth int, maxLines int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		for {
+			if len(lines) == maxLines {
+				last := lines[maxLines-1]
+				if fitted, _ := t.fit(last, maxWidth-t.width(t.ellipsis)); fitted != last {
+					lines[maxLines-1] = fitted
+				} else {
+					lines[maxLines-1] = last + t.ellipsis
+				}
+				return lines
+			}
+			cut, width := len(paragraph), 0
+			for i, r := range paragraph {
+				w := t.runeWidth(r)
+				if width+w > maxWidth && i > 0 {
+					cut = i
+					break
+				}
+				width += w
+			}
+			lines = append(lines, paragraph[:cut])
+			paragraph = paragraph[cut:]
+			if paragraph == "" {
+				break
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/triiberg/smartpasta/internal/config"
+)
+
+const (
+	defaultFontSize = 13
+	baseDPI         = 96
+)
+
+// metrics holds the picker's pixel sizes, derived from the font and the
+// configured padding after HiDPI scaling.
+type metrics struct {
+	padding          int
+	lineHeight       int
+	baseline         int
+	footerHeight     int
+	indexWidth       int
+	badgeWidth       int
+	swatchSize       int
+	snippetNameWidth int
+	showFooter       bool
+}
+
+func newMetrics(text *textRenderer, cfg config.UIConfig, scale float64) metrics {
+	gap := scaled(5, scale)
+	lineHeight := text.ascent + text.descent + gap
+	charWidth := text.runeWidth('0')
+	m := metrics{
+		padding:          scaled(cfg.Padding, scale),
+		lineHeight:       lineHeight,
+		baseline:         lineHeight - gap/2 - text.descent,
+		indexWidth:       3 * charWidth,
+		badgeWidth:       7 * charWidth,
+		swatchSize:       text.ascent - 1,
+		snippetNameWidth: 16 * charWidth,
+		showFooter:       cfg.ShowFooter,
+	}
+	if m.showFooter {
+		m.footerHeight = lineHeight
+	}
+	return m
+}
+
+func scaled(n int, scale float64) int {
+	return int(math.Round(float64(n) * scale))
+}
+
+// fontNames lists the core fonts to try for cfg, best first, ending with
+// the built-in defaults.
+func fontNames(cfg config.UIConfig, scale float64) []string {
+	var names []string
+	size := scaled(cfg.FontSize, scale)
+	switch {
+	case strings.HasPrefix(cfg.Font, "-"):
+		names = append(names, cfg.Font)
+	case cfg.Font != "" || size != defaultFontSize:
+		family := cfg.Font
+		if family == "" {
+			family = "fixed"
+		}
+		names = append(names, fmt.Sprintf("-*-%s-medium-r-*--%d-*-*-*-*-*-iso10646-1", family, size))
+	}
+	return append(names, unicodeFontName, fallbackFontName)
+}
+
+// dpiScale returns the HiDPI scale factor from the Xft.dpi resource in the
+// root window's RESOURCE_MANAGER property, or 1 when it is not set.
+func dpiScale(conn *xgb.Conn, root xproto.Window) float64 {
+	atom, err := internAtom(conn, "RESOURCE_MANAGER")
+	if err != nil {
+		return 1
+	}
+	reply, err := xproto.GetProperty(conn, false, root, atom, xproto.AtomString, 0, 1<<16).Reply()
+	if err != nil {
+		return 1
+	}
+	for _, line := range strings.Split(string(reply.Value), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) != "Xft.dpi" {
+			continue
+		}
+		dpi, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || dpi < baseDPI {
+			return 1
+		}
+		return dpi / baseDPI
+	}
+	return 1
+}
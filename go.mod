@@ -1,4 +1,4 @@
-module smartpasta
+module github.com/triiberg/smartpasta
 
 go 1.21
 
@@ -0,0 +1,218 @@
+package classify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	KindText   = "text"
+	KindURL    = "url"
+	KindPath   = "path"
+	KindJSON   = "json"
+	KindEmail  = "email"
+	KindColor  = "color"
+	KindNumber = "number"
+	KindCode   = "code"
+)
+
+const maxPathLength = 4096
+
+var (
+	hexColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	rgbColorPattern = regexp.MustCompile(`^rgba?\(\s*(\d{1,3})\s*,\s*(\d{1,3})\s*,\s*(\d{1,3})\s*(,\s*[0-9.]+\s*)?\)$`)
+	codeHints       = []string{
+		"func ", "def ", "class ", "import ", "package ", "#include", "return ", "=>",
+		"function ", "const ", "let ", "var ", "if (", "for (", "while (", "fn ", "SELECT ",
+	}
+)
+
+type Result struct {
+	Kind string
+	Meta map[string]string
+}
+
+func Classify(content string) Result {
+	text := strings.TrimSpace(content)
+	if text == "" {
+		return Result{Kind: KindText}
+	}
+
+	if !strings.ContainsAny(text, "\r\n") {
+		if result, ok := classifyURL(text); ok {
+			return result
+		}
+		if result, ok := classifyEmail(text); ok {
+			return result
+		}
+		if result, ok := classifyColor(text); ok {
+			return result
+		}
+		if result, ok := classifyNumber(text); ok {
+			return result
+		}
+	}
+	if result, ok := classifyJSON(text); ok {
+		return result
+	}
+	if !strings.ContainsAny(text, "\r\n") {
+		if result, ok := classifyPath(text); ok {
+			return result
+		}
+	}
+	if looksLikeCode(text) {
+		return Result{Kind: KindCode}
+	}
+	return Result{Kind: KindText}
+}
+
+func classifyURL(text string) (Result, bool) {
+	if strings.ContainsAny(text, " \t") {
+		return Result{}, false
+	}
+	parsed, err := url.Parse(text)
+	if err != nil {
+		return Result{}, false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "ftp", "ftps", "ws", "wss", "ssh", "git":
+	default:
+		return Result{}, false
+	}
+	if parsed.Host == "" {
+		return Result{}, false
+	}
+	return Result{Kind: KindURL, Meta: map[string]string{
+		"scheme": strings.ToLower(parsed.Scheme),
+		"host":   parsed.Hostname(),
+	}}, true
+}
+
+func classifyEmail(text string) (Result, bool) {
+	if strings.Count(text, "@") != 1 || strings.ContainsAny(text, " \t<>") {
+		return Result{}, false
+	}
+	addr, err := mail.ParseAddress(text)
+	if err != nil || addr.Address != text {
+		return Result{}, false
+	}
+	domain := text[strings.LastIndex(text, "@")+1:]
+	if !strings.Contains(domain, ".") {
+		return Result{}, false
+	}
+	return Result{Kind: KindEmail, Meta: map[string]string{"domain": domain}}, true
+}
+
+func classifyColor(text string) (Result, bool) {
+	if hexColorPattern.MatchString(text) {
+		hex := strings.ToLower(text[1:])
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		return Result{Kind: KindColor, Meta: map[string]string{"hex": hex[:6]}}, true
+	}
+	match := rgbColorPattern.FindStringSubmatch(strings.ToLower(text))
+	if match == nil {
+		return Result{}, false
+	}
+	hex := ""
+	for _, part := range match[1:4] {
+		value, err := strconv.Atoi(part)
+		if err != nil || value > 255 {
+			return Result{}, false
+		}
+		hex += fmt.Sprintf("%02x", value)
+	}
+	return Result{Kind: KindColor, Meta: map[string]string{"hex": hex}}, true
+}
+
+func classifyNumber(text string) (Result, bool) {
+	normalized := strings.ReplaceAll(text, "_", "")
+	if _, err := strconv.ParseInt(normalized, 0, 64); err == nil {
+		return Result{Kind: KindNumber, Meta: map[string]string{"format": "integer"}}, true
+	}
+	if _, err := strconv.ParseFloat(normalized, 64); err == nil {
+		lower := strings.ToLower(normalized)
+		if strings.Contains(lower, "inf") || strings.Contains(lower, "nan") {
+			return Result{}, false
+		}
+		return Result{Kind: KindNumber, Meta: map[string]string{"format": "float"}}, true
+	}
+	return Result{}, false
+}
+
+func classifyJSON(text string) (Result, bool) {
+	var shape string
+	switch {
+	case strings.HasPrefix(text, "{") && strings.HasSuffix(text, "}"):
+		shape = "object"
+	case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+		shape = "array"
+	default:
+		return Result{}, false
+	}
+	if !json.Valid([]byte(text)) {
+		if shape == "object" && strings.Contains(text, "\":") {
+			return Result{Kind: KindJSON, Meta: map[string]string{"valid": "false", "type": shape}}, true
+		}
+		return Result{}, false
+	}
+	return Result{Kind: KindJSON, Meta: map[string]string{"valid": "true", "type": shape}}, true
+}
+
+func classifyPath(text string) (Result, bool) {
+	if len(text) > maxPathLength {
+		return Result{}, false
+	}
+	path := text
+	switch {
+	case strings.HasPrefix(path, "~/"):
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return Result{}, false
+		}
+		path = filepath.Join(homeDir, path[2:])
+	case strings.HasPrefix(path, "/"), strings.HasPrefix(path, "./"), strings.HasPrefix(path, "../"):
+	default:
+		return Result{}, false
+	}
+	if strings.HasPrefix(text, "//") {
+		return Result{}, false
+	}
+
+	meta := map[string]string{"exists": "false"}
+	if info, err := os.Stat(path); err == nil {
+		meta["exists"] = "true"
+		if info.IsDir() {
+			meta["dir"] = "true"
+		}
+	}
+	return Result{Kind: KindPath, Meta: meta}, true
+}
+
+func looksLikeCode(text string) bool {
+	score := 0
+	for _, hint := range codeHints {
+		if strings.Contains(text, hint) {
+			score++
+		}
+	}
+	lines := strings.Split(text, "\n")
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasSuffix(trimmed, ";") || strings.HasSuffix(trimmed, "{") || trimmed == "}" {
+			score++
+		}
+	}
+	if len(lines) > 1 {
+		return score >= 2
+	}
+	return score >= 2 && strings.ContainsAny(text, "(){};=")
+}
@@ -3,6 +3,8 @@ package clipboard
 import (
 	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"sync"
 
 	"github.com/BurntSushi/xgb"
@@ -17,6 +19,7 @@ type Manager struct {
 	atoms    map[string]xproto.Atom
 	mu       sync.Mutex
 	current  string
+	owner    xproto.Window
 	maxBytes int
 	logger   func(string, ...any)
 }
@@ -87,6 +90,7 @@ func NewManager(maxBytes int, display string, logger func(string, ...any)) (*Man
 		"TEXT",
 		"STRING",
 		"SMARTPASTA_CLIP",
+		"_NET_WM_PID",
 	})
 	if err != nil {
 		conn.Close()
@@ -161,7 +165,10 @@ func (m *Manager) Current() string {
 	return m.current
 }
 
-func (m *Manager) Run(onNew func(string)) error {
+// Run processes X11 events until the connection closes. onNew receives each
+// captured clipboard text and the name of the application that owned it, if
+// it could be determined.
+func (m *Manager) Run(onNew func(content string, source string)) error {
 	if onNew == nil {
 		return errors.New("onNew callback required")
 	}
@@ -219,6 +226,7 @@ func (m *Manager) requestClipboard() {
 	owner, err := xproto.GetSelectionOwner(m.conn, m.atoms["CLIPBOARD"]).Reply()
 	if err == nil {
 		m.logf("clipboard owner window=%d", owner.Owner)
+		m.owner = owner.Owner
 	}
 
 	m.requestClipboardTarget(m.atoms["UTF8_STRING"])
@@ -263,7 +271,7 @@ func (m *Manager) requestTargets() {
 	).Check()
 }
 
-func (m *Manager) handleSelectionNotify(ev xproto.SelectionNotifyEvent, onNew func(string)) {
+func (m *Manager) handleSelectionNotify(ev xproto.SelectionNotifyEvent, onNew func(string, string)) {
 	if ev.Selection != m.atoms["CLIPBOARD"] {
 		m.logf("SelectionNotify ignored selection=%s(%d)", m.atomName(ev.Selection), ev.Selection)
 		return
@@ -305,7 +313,35 @@ func (m *Manager) handleSelectionNotify(ev xproto.SelectionNotifyEvent, onNew fu
 
 	// Store the clipboard contents. The callback is responsible for re-acquiring
 	// ownership (SetSelectionOwner) so we continue receiving SelectionClear events.
-	onNew(content)
+	onNew(content, m.ownerName(m.owner))
+}
+
+// ownerName identifies the application behind a selection owner window by
+// WM_CLASS, walking up to the nearest ancestor that has one, and falls back
+// to the process name from _NET_WM_PID.
+func (m *Manager) ownerName(window xproto.Window) string {
+	for window != 0 && window != m.window {
+		reply, err := xproto.GetProperty(m.conn, false, window, xproto.AtomWmClass, xproto.AtomString, 0, 256).Reply()
+		if err == nil && len(reply.Value) > 0 {
+			parts := strings.Split(strings.TrimRight(string(reply.Value), "\x00"), "\x00")
+			return parts[len(parts)-1]
+		}
+		if pid := m.atoms["_NET_WM_PID"]; pid != xproto.AtomNone {
+			reply, err := xproto.GetProperty(m.conn, false, window, pid, xproto.AtomCardinal, 0, 1).Reply()
+			if err == nil && reply.Format == 32 && len(reply.Value) >= 4 {
+				comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", xgb.Get32(reply.Value)))
+				if err == nil {
+					return strings.TrimSpace(string(comm))
+				}
+			}
+		}
+		tree, err := xproto.QueryTree(m.conn, window).Reply()
+		if err != nil || tree.Parent == tree.Root {
+			return ""
+		}
+		window = tree.Parent
+	}
+	return ""
 }
 
 func (m *Manager) handleTargetsNotify(ev xproto.SelectionNotifyEvent) {
@@ -0,0 +1,328 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const fileName = "smartpasta.conf"
+
+// Config is the shared configuration for the daemon and the UI, read from
+// an INI-style file:
+//
+//	[paste]
+//	enabled = true
+//	app.xterm = shift+insert
+//
+//	[ui]
+//	width = 800
+//	highlight = #44475a
+//
+//	[access]
+//	/usr/local/bin/smartpasta-ui = all
+//	* = add
+type Config struct {
+	Paste  PasteConfig
+	UI     UIConfig
+	Access AccessConfig
+}
+
+type PasteConfig struct {
+	Enabled      bool
+	Keys         string
+	TerminalKeys string
+	Terminals    []string
+	// Apps maps a lower-case WM_CLASS name to the keys used for that
+	// application, or "off" to disable auto-paste for it.
+	Apps map[string]string
+}
+
+// UIConfig controls the picker's look. Sizes are in pixels at 96 DPI and are
+// scaled for HiDPI screens; colors are "rrggbb" hex.
+type UIConfig struct {
+	Background    string
+	Text          string
+	Highlight     string
+	HighlightText string
+	FooterText    string
+	Match         string
+	// Font is a core font family (e.g. "fixed", "terminus") or a full XLFD
+	// name starting with "-". Empty means the built-in default.
+	Font       string
+	FontSize   int
+	Width      int
+	MaxRows    int
+	Padding    int
+	ShowFooter bool
+	// Scale overrides the scale factor derived from Xft.dpi; 0 means auto.
+	Scale float64
+	// Hotkey is the shortcut that opens the picker; pressing it again, or
+	// launching a second picker, closes the open one or with Cycle moves its
+	// highlight to the next entry.
+	Hotkey string
+	Cycle  bool
+}
+
+// AccessConfig limits which IPC ops each client executable may use. Rules
+// maps an absolute executable path or "*" to op names and groups; no rules
+// means every client may use every op. Paths keep their case.
+type AccessConfig struct {
+	Rules map[string][]string
+}
+
+func Default() *Config {
+	return &Config{
+		Paste: PasteConfig{
+			Keys:         "ctrl+v",
+			TerminalKeys: "ctrl+shift+v",
+			Terminals: []string{
+				"xfce4-terminal", "gnome-terminal", "gnome-terminal-server", "konsole",
+				"terminator", "tilix", "alacritty", "kitty", "urxvt", "rxvt", "st",
+				"sakura", "lxterminal", "mate-terminal", "qterminal", "wezterm", "foot",
+			},
+			Apps: map[string]string{"xterm": "shift+insert"},
+		},
+		UI: UIConfig{
+			Background:    "1e1e1e",
+			Text:          "e0e0e0",
+			Highlight:     "2f5d8a",
+			HighlightText: "ffffff",
+			FooterText:    "aaaaaa",
+			Match:         "e5c07b",
+			FontSize:      13,
+			Width:         640,
+			Padding:       10,
+			ShowFooter:    true,
+			Hotkey:        "super+v",
+		},
+	}
+}
+
+// Dir returns the smartpasta configuration directory
+// (~/.config/smartpasta by default).
+func Dir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		configDir = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configDir, "smartpasta"), nil
+}
+
+func DefaultPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fileName), nil
+}
+
+// Load reads the config file at path. A missing file yields the defaults.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	sections, invalid, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(invalid) > 0 {
+		return nil, invalid[0].err
+	}
+	if err := cfg.Paste.apply(sections["paste"]); err != nil {
+		return nil, fmt.Errorf("%s: [paste] %w", path, err)
+	}
+	if err := cfg.UI.apply(sections["ui"]); err != nil {
+		return nil, fmt.Errorf("%s: [ui] %w", path, err)
+	}
+	cfg.Access.apply(sections["access"])
+	return cfg, nil
+}
+
+// LoadAccess reads only the [access] section of the config file at path,
+// so that mistakes elsewhere in the file do not affect it. A missing file
+// or section yields no rules.
+func LoadAccess(path string) (AccessConfig, error) {
+	var access AccessConfig
+	sections, invalid, err := read(path)
+	if err != nil {
+		return access, err
+	}
+	for _, line := range invalid {
+		if line.section == "access" {
+			return access, line.err
+		}
+	}
+	access.apply(sections["access"])
+	return access, nil
+}
+
+// read parses the config file at path. A missing file has no sections.
+func read(path string) (map[string]map[string]string, []syntaxError, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	defer file.Close()
+	return parse(file.Name(), bufio.NewScanner(file))
+}
+
+func (p *PasteConfig) apply(values map[string]string) error {
+	for key, value := range values {
+		switch {
+		case key == "enabled":
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("enabled: %w", err)
+			}
+			p.Enabled = enabled
+		case key == "keys":
+			p.Keys = value
+		case key == "terminal_keys":
+			p.TerminalKeys = value
+		case key == "terminals":
+			p.Terminals = splitList(value)
+		case strings.HasPrefix(key, "app."):
+			p.Apps[strings.ToLower(strings.TrimPrefix(key, "app."))] = strings.ToLower(value)
+		default:
+			return fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return nil
+}
+
+func (u *UIConfig) apply(values map[string]string) error {
+	colors := map[string]*string{
+		"background":     &u.Background,
+		"text":           &u.Text,
+		"highlight":      &u.Highlight,
+		"highlight_text": &u.HighlightText,
+		"footer_text":    &u.FooterText,
+		"match":          &u.Match,
+	}
+	sizes := map[string]*int{
+		"font_size": &u.FontSize,
+		"width":     &u.Width,
+		"max_rows":  &u.MaxRows,
+		"padding":   &u.Padding,
+	}
+	for key, value := range values {
+		if color, ok := colors[key]; ok {
+			hex := strings.ToLower(strings.TrimPrefix(value, "#"))
+			if _, err := strconv.ParseUint(hex, 16, 32); err != nil || len(hex) != 6 {
+				return fmt.Errorf("%s: invalid color %q", key, value)
+			}
+			*color = hex
+			continue
+		}
+		if size, ok := sizes[key]; ok {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%s: invalid size %q", key, value)
+			}
+			*size = n
+			continue
+		}
+		switch key {
+		case "font":
+			u.Font = value
+		case "show_footer":
+			show, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("show_footer: %w", err)
+			}
+			u.ShowFooter = show
+		case "hotkey":
+			u.Hotkey = value
+		case "cycle":
+			cycle, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("cycle: %w", err)
+			}
+			u.Cycle = cycle
+		case "scale":
+			scale, err := strconv.ParseFloat(value, 64)
+			if err != nil || scale < 0 {
+				return fmt.Errorf("scale: invalid value %q", value)
+			}
+			u.Scale = scale
+		default:
+			return fmt.Errorf("unknown key %q", key)
+		}
+	}
+	if u.FontSize == 0 || u.Width == 0 {
+		return errors.New("font_size and width must be positive")
+	}
+	return nil
+}
+
+func (a *AccessConfig) apply(values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	a.Rules = make(map[string][]string)
+	for key, value := range values {
+		a.Rules[key] = splitList(value)
+	}
+}
+
+// syntaxError is a malformed line. Parsing goes on past it, so that a
+// broken section does not hide the others.
+type syntaxError struct {
+	section string
+	err     error
+}
+
+func parse(name string, scanner *bufio.Scanner) (map[string]map[string]string, []syntaxError, error) {
+	sections := make(map[string]map[string]string)
+	var invalid []syntaxError
+	section := ""
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			invalid = append(invalid, syntaxError{section, fmt.Errorf("%s:%d: expected key = value", name, lineNo)})
+			continue
+		}
+		if sections[section] == nil {
+			sections[section] = make(map[string]string)
+		}
+		key = strings.TrimSpace(key)
+		if section != "access" {
+			key = strings.ToLower(key)
+		}
+		sections[section][key] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return sections, invalid, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,187 @@
+package history
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
+)
+
+const (
+	DefaultBoard      = protocol.DefaultBoard
+	maxBoardNameBytes = 32
+)
+
+var (
+	ErrBoardNotFound    = errors.New("board not found")
+	ErrBoardExists      = errors.New("board already exists")
+	ErrInvalidBoardName = errors.New("invalid board name")
+	ErrDefaultBoard     = errors.New("default board cannot be deleted")
+)
+
+type BoardInfo = protocol.BoardInfo
+
+// Boards keeps one History per named board. Capture goes into the active
+// board; operations that name no board use it as well.
+type Boards struct {
+	mu         sync.Mutex
+	boards     map[string]*History
+	active     string
+	maxEntries int
+	maxBytes   int
+	ids        *atomic.Int64
+	observe    func(Change)
+}
+
+func NewBoards(maxEntries int, maxBytes int) *Boards {
+	b := &Boards{
+		boards:     make(map[string]*History),
+		active:     DefaultBoard,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ids:        new(atomic.Int64),
+	}
+	b.boards[DefaultBoard] = newWithIDs(maxEntries, maxBytes, b.ids)
+	return b
+}
+
+// Get returns the named board, or the active board when name is empty.
+func (b *Boards) Get(name string) (*History, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if name == "" {
+		name = b.active
+	}
+	board, ok := b.boards[name]
+	if !ok {
+		return nil, ErrBoardNotFound
+	}
+	return board, nil
+}
+
+// MaxBytes returns the largest entry the boards accept.
+func (b *Boards) MaxBytes() int {
+	if b.maxBytes <= 0 {
+		return DefaultMaxBytes
+	}
+	return b.maxBytes
+}
+
+// Capture adds content to the active board. The boards stay locked while
+// it does, so a board deleted concurrently is never written to.
+func (b *Boards) Capture(content string, opts AddOptions) (string, Entry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, err := b.boards[b.active].AddWithOptions(content, opts)
+	return b.active, entry, err
+}
+
+func (b *Boards) List() []BoardInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	infos := make([]BoardInfo, 0, len(b.boards))
+	for name, board := range b.boards {
+		infos = append(infos, BoardInfo{Name: name, Active: name == b.active, Entries: board.Len()})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name == DefaultBoard || infos[j].Name == DefaultBoard {
+			return infos[i].Name == DefaultBoard
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+func (b *Boards) Create(name string) error {
+	if !validBoardName(name) {
+		return ErrInvalidBoardName
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.boards[name]; ok {
+		return ErrBoardExists
+	}
+	board := newWithIDs(b.maxEntries, b.maxBytes, b.ids)
+	board.setObserver(name, b.observe)
+	b.boards[name] = board
+	return nil
+}
+
+func (b *Boards) Switch(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.boards[name]; !ok {
+		return ErrBoardNotFound
+	}
+	b.active = name
+	return nil
+}
+
+// Delete removes a board and its entries. Deleting the active board makes
+// the default board active again. Observers get a board deleted change and
+// nothing more from the board, even from operations already holding it.
+func (b *Boards) Delete(name string) error {
+	if name == DefaultBoard {
+		return ErrDefaultBoard
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	board, ok := b.boards[name]
+	if !ok {
+		return ErrBoardNotFound
+	}
+	delete(b.boards, name)
+	if b.active == name {
+		b.active = DefaultBoard
+	}
+	board.setObserver(name, nil)
+	if b.observe != nil {
+		b.observe(Change{Type: ChangeBoardDeleted, Board: name})
+	}
+	return nil
+}
+
+// Move transfers an entry to the top of another board.
+func (b *Boards) Move(id int64, from string, to string) (Entry, error) {
+	source, err := b.Get(from)
+	if err != nil {
+		return Entry{}, err
+	}
+	target, err := b.Get(to)
+	if err != nil {
+		return Entry{}, err
+	}
+	if source == target {
+		return source.Get(id)
+	}
+	entry, err := source.Remove(id)
+	if err != nil {
+		return Entry{}, err
+	}
+	target.Insert(entry)
+	return entry, nil
+}
+
+func validBoardName(name string) bool {
+	if name == "" || len(name) > maxBoardNameBytes || strings.TrimSpace(name) != name {
+		return false
+	}
+	for _, r := range name {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || r == '/' {
+			return false
+		}
+	}
+	return true
+}
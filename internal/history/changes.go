@@ -0,0 +1,45 @@
+package history
+
+import "github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
+
+const (
+	ChangeAdded    = protocol.ChangeAdded
+	ChangeSelected = protocol.ChangeSelected
+	ChangeUpdated  = protocol.ChangeUpdated
+	ChangeDeleted  = protocol.ChangeDeleted
+	ChangeCleared  = protocol.ChangeCleared
+
+	ChangeBoardDeleted = protocol.ChangeBoardDeleted
+)
+
+type Change = protocol.Change
+
+// emit reports a change to the observer. It is called with h.mu held so
+// observers see changes in order; they must not call back into the history.
+func (h *History) emit(change Change) {
+	if h.observe == nil {
+		return
+	}
+	change.Board = h.name
+	h.observe(change)
+}
+
+func (h *History) setObserver(name string, observe func(Change)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.name = name
+	h.observe = observe
+}
+
+// Observe registers fn to receive every change made to any board, including
+// boards created later.
+func (b *Boards) Observe(fn func(Change)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.observe = fn
+	for name, board := range b.boards {
+		board.setObserver(name, fn)
+	}
+}
@@ -3,20 +3,32 @@ package history
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/triiberg/smartpasta/internal/classify"
+	"github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
 )
 
 const (
 	DefaultMaxEntries = 20
-	DefaultMaxBytes   = 1 << 20
+	DefaultMaxBytes   = protocol.DefaultMaxBytes
+)
+
+var (
+	ErrNotFound       = errors.New("entry not found")
+	ErrInvalidContent = errors.New("invalid content")
+	ErrTooLarge       = errors.New("content too large")
+	ErrDuplicate      = errors.New("duplicate of the latest entry")
 )
 
-var ErrNotFound = errors.New("entry not found")
+type Entry = protocol.Entry
 
-type Entry struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+// AddOptions carries optional metadata for a new entry.
+type AddOptions struct {
+	Source    string
+	Pinned    bool
+	Sensitive bool
 }
 
 type History struct {
@@ -24,10 +36,19 @@ type History struct {
 	entries  []Entry
 	max      int
 	maxBytes int
-	nextID   int64
+	ids      *atomic.Int64
+	index    *index
+	name     string
+	observe  func(Change)
 }
 
 func New(maxEntries int, maxBytes int) *History {
+	return newWithIDs(maxEntries, maxBytes, new(atomic.Int64))
+}
+
+// newWithIDs creates a history drawing entry IDs from a shared counter, so
+// entries keep unique IDs when moved between boards.
+func newWithIDs(maxEntries int, maxBytes int, ids *atomic.Int64) *History {
 	if maxEntries <= 0 {
 		maxEntries = DefaultMaxEntries
 	}
@@ -37,36 +58,92 @@ func New(maxEntries int, maxBytes int) *History {
 	return &History{
 		max:      maxEntries,
 		maxBytes: maxBytes,
-		nextID:   1,
+		ids:      ids,
+		index:    newIndex(),
 	}
 }
 
 func (h *History) Add(content string) (Entry, bool) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	entry, err := h.AddWithOptions(content, AddOptions{})
+	return entry, err == nil
+}
 
+// AddWithOptions adds content as the newest entry. Content equal to the
+// newest entry is not added again; ErrDuplicate is returned with that
+// entry, which takes on the pinned and sensitive flags set in opts. Flags
+// are only ever set this way, never cleared.
+func (h *History) AddWithOptions(content string, opts AddOptions) (Entry, error) {
 	if content == "" {
-		return Entry{}, false
+		return Entry{}, ErrInvalidContent
 	}
 	if len(content) > h.maxBytes {
-		return Entry{}, false
+		return Entry{}, ErrTooLarge
 	}
+
+	// Classification may touch the filesystem (path existence), so it runs
+	// before taking the lock.
+	class := classify.Classify(content)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	if len(h.entries) > 0 && h.entries[0].Content == content {
-		return Entry{}, false
+		top := &h.entries[0]
+		if (opts.Pinned && !top.Pinned) || (opts.Sensitive && !top.Sensitive) {
+			top.Pinned = top.Pinned || opts.Pinned
+			top.Sensitive = top.Sensitive || opts.Sensitive
+			updated := *top
+			h.emit(Change{Type: ChangeUpdated, Entry: &updated})
+		}
+		return h.entries[0], ErrDuplicate
 	}
 
 	entry := Entry{
-		ID:        h.nextID,
+		ID:        h.ids.Add(1),
 		Content:   content,
 		CreatedAt: time.Now(),
+		Kind:      class.Kind,
+		Meta:      class.Meta,
+		Source:    opts.Source,
+		Pinned:    opts.Pinned,
+		Sensitive: opts.Sensitive,
 	}
-	h.nextID++
 
+	h.insert(entry)
+	return entry, nil
+}
+
+// Insert places an existing entry at the top of the history, keeping its ID.
+func (h *History) Insert(entry Entry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.insert(entry)
+}
+
+// insert evicts the oldest unpinned entries once the history is full. The new
+// entry and pinned entries are never evicted, so a history whose other
+// entries are all pinned grows past its limit.
+func (h *History) insert(entry Entry) {
 	h.entries = append([]Entry{entry}, h.entries...)
-	if len(h.entries) > h.max {
-		h.entries = h.entries[:h.max]
+	h.index.add(entry)
+	h.emit(Change{Type: ChangeAdded, Entry: &entry})
+	for i := len(h.entries) - 1; i > 0 && len(h.entries) > h.max; i-- {
+		if h.entries[i].Pinned {
+			continue
+		}
+		evicted := h.entries[i].ID
+		h.index.remove(evicted)
+		h.entries = append(h.entries[:i], h.entries[i+1:]...)
+		h.emit(Change{Type: ChangeDeleted, ID: evicted})
 	}
-	return entry, true
+}
+
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.entries)
 }
 
 func (h *History) ListMRU() []Entry {
@@ -89,38 +166,114 @@ func (h *History) ListChronological() []Entry {
 	return entries
 }
 
+func (h *History) Get(id int64) (Entry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, entry := range h.entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
 func (h *History) Select(id int64) (Entry, error) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
 	for i, entry := range h.entries {
 		if entry.ID == id {
-			if i == 0 {
-				return entry, nil
+			if i > 0 {
+				h.entries = append([]Entry{entry}, append(h.entries[:i], h.entries[i+1:]...)...)
 			}
-			h.entries = append([]Entry{entry}, append(h.entries[:i], h.entries[i+1:]...)...)
+			h.emit(Change{Type: ChangeSelected, Entry: &entry})
 			return entry, nil
 		}
 	}
 	return Entry{}, ErrNotFound
 }
 
+func (h *History) Update(id int64, content string) (Entry, error) {
+	if content == "" {
+		return Entry{}, ErrInvalidContent
+	}
+	if len(content) > h.maxBytes {
+		return Entry{}, ErrTooLarge
+	}
+	class := classify.Classify(content)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := range h.entries {
+		if h.entries[i].ID == id {
+			edited := time.Now()
+			h.entries[i].Content = content
+			h.entries[i].Kind = class.Kind
+			h.entries[i].Meta = class.Meta
+			h.entries[i].EditedAt = &edited
+			h.index.remove(id)
+			h.index.add(h.entries[i])
+			updated := h.entries[i]
+			h.emit(Change{Type: ChangeUpdated, Entry: &updated})
+			return updated, nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
+// SetPinned pins or unpins an entry. Pinned entries survive eviction and
+// Clear.
+func (h *History) SetPinned(id int64, pinned bool) (Entry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := range h.entries {
+		if h.entries[i].ID == id {
+			h.entries[i].Pinned = pinned
+			updated := h.entries[i]
+			h.emit(Change{Type: ChangeUpdated, Entry: &updated})
+			return updated, nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
 func (h *History) Delete(id int64) error {
+	_, err := h.Remove(id)
+	return err
+}
+
+// Remove deletes an entry and returns it.
+func (h *History) Remove(id int64) (Entry, error) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
 	for i, entry := range h.entries {
 		if entry.ID == id {
 			h.entries = append(h.entries[:i], h.entries[i+1:]...)
-			return nil
+			h.index.remove(id)
+			h.emit(Change{Type: ChangeDeleted, ID: id})
+			return entry, nil
 		}
 	}
-	return ErrNotFound
+	return Entry{}, ErrNotFound
 }
 
+// Clear removes all entries except pinned ones.
 func (h *History) Clear() {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	h.entries = nil
+	var kept []Entry
+	h.index.reset()
+	for _, entry := range h.entries {
+		if entry.Pinned {
+			kept = append(kept, entry)
+			h.index.add(entry)
+		}
+	}
+	h.entries = kept
+	h.emit(Change{Type: ChangeCleared})
 }
@@ -0,0 +1,116 @@
+package history
+
+import "unicode"
+
+// maxIndexedBytes bounds the trigram index per entry. Larger entries are
+// always treated as candidates and verified by scanning.
+const maxIndexedBytes = 64 << 10
+
+type trigram [3]rune
+
+// index maps case-folded trigrams to the entries containing them, so
+// substring searches only verify a small candidate set.
+type index struct {
+	postings  map[trigram]map[int64]struct{}
+	grams     map[int64][]trigram
+	unindexed map[int64]struct{}
+}
+
+func newIndex() *index {
+	return &index{
+		postings:  make(map[trigram]map[int64]struct{}),
+		grams:     make(map[int64][]trigram),
+		unindexed: make(map[int64]struct{}),
+	}
+}
+
+func (x *index) add(entry Entry) {
+	if len(entry.Content) > maxIndexedBytes {
+		x.unindexed[entry.ID] = struct{}{}
+		return
+	}
+	grams := trigrams(foldRunes(entry.Content))
+	x.grams[entry.ID] = grams
+	for _, gram := range grams {
+		ids, ok := x.postings[gram]
+		if !ok {
+			ids = make(map[int64]struct{})
+			x.postings[gram] = ids
+		}
+		ids[entry.ID] = struct{}{}
+	}
+}
+
+func (x *index) remove(id int64) {
+	delete(x.unindexed, id)
+	for _, gram := range x.grams[id] {
+		ids := x.postings[gram]
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(x.postings, gram)
+		}
+	}
+	delete(x.grams, id)
+}
+
+func (x *index) reset() {
+	*x = *newIndex()
+}
+
+// candidates returns the entries that may contain query, or ok=false when
+// the query is too short to narrow the search.
+func (x *index) candidates(query string) (map[int64]struct{}, bool) {
+	grams := trigrams(foldRunes(query))
+	if len(grams) == 0 {
+		return nil, false
+	}
+
+	var result map[int64]struct{}
+	for _, gram := range grams {
+		ids := x.postings[gram]
+		if result == nil {
+			result = make(map[int64]struct{}, len(ids))
+			for id := range ids {
+				result[id] = struct{}{}
+			}
+			continue
+		}
+		for id := range result {
+			if _, ok := ids[id]; !ok {
+				delete(result, id)
+			}
+		}
+		if len(result) == 0 {
+			break
+		}
+	}
+	for id := range x.unindexed {
+		result[id] = struct{}{}
+	}
+	return result, true
+}
+
+func trigrams(runes []rune) []trigram {
+	if len(runes) < 3 {
+		return nil
+	}
+	seen := make(map[trigram]struct{}, len(runes))
+	grams := make([]trigram, 0, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		gram := trigram{runes[i], runes[i+1], runes[i+2]}
+		if _, ok := seen[gram]; ok {
+			continue
+		}
+		seen[gram] = struct{}{}
+		grams = append(grams, gram)
+	}
+	return grams
+}
+
+func foldRunes(text string) []rune {
+	runes := []rune(text)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
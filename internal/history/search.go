@@ -0,0 +1,214 @@
+package history
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
+)
+
+const (
+	SearchSubstring       = protocol.SearchSubstring
+	SearchCaseInsensitive = protocol.SearchCaseInsensitive
+	SearchFuzzy           = protocol.SearchFuzzy
+	SearchRegex           = protocol.SearchRegex
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+type (
+	Query = protocol.Query
+	Match = protocol.Match
+)
+
+// Search returns matching entries ranked by score, most recent first on
+// ties, together with the total number of matches before paging.
+func (h *History) Search(query Query) ([]Match, int, error) {
+	if query.Text == "" {
+		return nil, 0, ErrInvalidQuery
+	}
+
+	var pattern *regexp.Regexp
+	switch query.Mode {
+	case "", SearchSubstring, SearchCaseInsensitive, SearchFuzzy:
+	case SearchRegex:
+		compiled, err := regexp.Compile(query.Text)
+		if err != nil {
+			return nil, 0, ErrInvalidQuery
+		}
+		pattern = compiled
+	default:
+		return nil, 0, ErrInvalidQuery
+	}
+
+	h.mu.Lock()
+	var candidates map[int64]struct{}
+	narrowed := false
+	if query.Mode == "" || query.Mode == SearchSubstring || query.Mode == SearchCaseInsensitive {
+		candidates, narrowed = h.index.candidates(query.Text)
+	}
+	entries := make([]Entry, 0, len(h.entries))
+	for _, entry := range h.entries {
+		if entry.Sensitive {
+			continue
+		}
+		if narrowed {
+			if _, ok := candidates[entry.ID]; !ok {
+				continue
+			}
+		}
+		entries = append(entries, entry)
+	}
+	h.mu.Unlock()
+
+	matches := make([]Match, 0, len(entries))
+	for _, entry := range entries {
+		var (
+			score     int
+			positions []int
+			ok        bool
+		)
+		switch query.Mode {
+		case "", SearchSubstring:
+			score, positions, ok = substringMatch(query.Text, entry.Content)
+		case SearchCaseInsensitive:
+			score, positions, ok = foldedSubstringMatch(query.Text, entry.Content)
+		case SearchFuzzy:
+			score, positions, ok = FuzzyMatch(query.Text, entry.Content)
+		case SearchRegex:
+			score, positions, ok = regexMatch(pattern, entry.Content)
+		}
+		if ok {
+			matches = append(matches, Match{Entry: entry, Score: score, Positions: positions})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	total := len(matches)
+	if query.Offset > 0 {
+		if query.Offset >= len(matches) {
+			return nil, total, nil
+		}
+		matches = matches[query.Offset:]
+	}
+	if query.Limit > 0 && len(matches) > query.Limit {
+		matches = matches[:query.Limit]
+	}
+	return matches, total, nil
+}
+
+// FuzzyMatch reports whether the characters of pattern appear in text in
+// order, ignoring case. Consecutive and word-start matches score higher.
+func FuzzyMatch(pattern string, text string) (int, []int, bool) {
+	if pattern == "" {
+		return 0, nil, true
+	}
+	needle := foldRunes(pattern)
+	positions := make([]int, 0, len(needle))
+	score := 0
+	matched := 0
+	last := -2
+	prev := rune(0)
+	for i, r := range text {
+		if matched == len(needle) {
+			break
+		}
+		if unicode.ToLower(r) == needle[matched] {
+			score++
+			if last >= 0 && i == last+utf8.RuneLen(prev) {
+				score += 5
+			}
+			if i == 0 || isBoundary(prev) {
+				score += 3
+			}
+			positions = append(positions, i)
+			last = i
+			matched++
+		}
+		prev = r
+	}
+	if matched < len(needle) {
+		return 0, nil, false
+	}
+	// Prefer tight matches: penalise the span the match covers.
+	span := positions[len(positions)-1] - positions[0]
+	score -= span / 8
+	return score, positions, true
+}
+
+func substringMatch(query string, text string) (int, []int, bool) {
+	start := strings.Index(text, query)
+	if start < 0 {
+		return 0, nil, false
+	}
+	return substringScore(text, start), runeOffsets(text, start, start+len(query)), true
+}
+
+func foldedSubstringMatch(query string, text string) (int, []int, bool) {
+	needle := foldRunes(query)
+	haystack := make([]rune, 0, len(text))
+	offsets := make([]int, 0, len(text))
+	for i, r := range text {
+		haystack = append(haystack, unicode.ToLower(r))
+		offsets = append(offsets, i)
+	}
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		if runesEqual(haystack[i:i+len(needle)], needle) {
+			start := offsets[i]
+			return substringScore(text, start), offsets[i : i+len(needle)], true
+		}
+	}
+	return 0, nil, false
+}
+
+func regexMatch(pattern *regexp.Regexp, text string) (int, []int, bool) {
+	loc := pattern.FindStringIndex(text)
+	if loc == nil {
+		return 0, nil, false
+	}
+	return substringScore(text, loc[0]), runeOffsets(text, loc[0], loc[1]), true
+}
+
+func substringScore(text string, start int) int {
+	switch {
+	case start == 0:
+		return 100
+	case isBoundary(lastRune(text[:start])):
+		return 50
+	default:
+		return 10
+	}
+}
+
+func runeOffsets(text string, start int, end int) []int {
+	offsets := make([]int, 0, end-start)
+	for i := range text[start:end] {
+		offsets = append(offsets, start+i)
+	}
+	return offsets
+}
+
+func runesEqual(a []rune, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func lastRune(text string) rune {
+	r, _ := utf8.DecodeLastRuneInString(text)
+	return r
+}
+
+func isBoundary(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
@@ -0,0 +1,7 @@
+package ipc
+
+import "github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
+
+func errorResponse(code string) Response {
+	return Response{Ok: false, Code: code, Error: protocol.Message(code)}
+}
@@ -0,0 +1,30 @@
+package ipc
+
+import "github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
+
+var ops = []string{
+	"hello", "history", "search", "add", "select", "update", "delete", "pin", "unpin",
+	"clear", "transform", "snippets", "snippet", "dump", "boards", "board_create",
+	"board_switch", "board_delete", "move", "subscribe",
+}
+
+// SetVersion sets the daemon version and build flavor reported by hello.
+func (s *Server) SetVersion(version, flavor string) {
+	s.version = version
+	s.flavor = flavor
+}
+
+func (s *Server) hello() *Hello {
+	capabilities := []string{"req_id", "error_codes", "sensitive", "paged", "jsonrpc"}
+	if s.snippets != nil {
+		capabilities = append(capabilities, "snippets")
+	}
+	return &Hello{
+		Protocol:     protocol.Version,
+		Version:      s.version,
+		Flavor:       s.flavor,
+		MaxBytes:     s.boards.MaxBytes(),
+		Ops:          ops,
+		Capabilities: capabilities,
+	}
+}
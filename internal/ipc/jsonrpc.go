@@ -0,0 +1,279 @@
+package ipc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
+)
+
+// JSON-RPC 2.0 error codes. Daemon errors use rpcServerError with the
+// protocol's error code in data.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+// headerLimit bounds one header line of a Content-Length framed message.
+const headerLimit = 1 << 10
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	// ID is nil for a notification, which gets no response.
+	ID json.RawMessage `json:"id"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int        `json:"code"`
+	Message string     `json:"message"`
+	Data    *rpcDetail `json:"data,omitempty"`
+}
+
+type rpcDetail struct {
+	Code string `json:"code"`
+}
+
+type rpcNotification struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// rpcConn reads and writes JSON-RPC messages, either one per line or
+// framed with Content-Length headers as editors' language clients do.
+type rpcConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	framed bool
+	limit  int
+}
+
+func (c *rpcConn) read() ([]byte, error) {
+	if !c.framed {
+		return protocol.ReadLine(c.reader, c.limit)
+	}
+	length := -1
+	for {
+		line, err := protocol.ReadLine(c.reader, headerLimit)
+		if err != nil {
+			return nil, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			break
+		}
+		name, value, ok := strings.Cut(string(line), ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil || length < 0 {
+				return nil, errors.New("invalid content length")
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing content length")
+	}
+	if length > c.limit {
+		if _, err := c.reader.Discard(length); err != nil {
+			return nil, err
+		}
+		return nil, protocol.ErrLineTooLong
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (c *rpcConn) write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if c.framed {
+		_, err = fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(data), data)
+		return err
+	}
+	_, err = c.conn.Write(append(data, '\n'))
+	return err
+}
+
+// isJSONRPC reports whether a first message is JSON-RPC rather than the
+// native protocol, which never sends arrays or a "jsonrpc" member.
+func isJSONRPC(line []byte) bool {
+	if line[0] == '[' {
+		return true
+	}
+	var probe struct {
+		JSONRPC *string `json:"jsonrpc"`
+	}
+	return json.Unmarshal(line, &probe) == nil && probe.JSONRPC != nil
+}
+
+// serveJSONRPC handles a connection in JSON-RPC 2.0 mode, starting with
+// first when the message that identified it has already been read. Methods
+// are the op names and params the other request members. After a
+// successful subscribe the connection carries "event" notifications only.
+func (s *Server) serveJSONRPC(rc *rpcConn, peer Peer, first []byte) {
+	for {
+		data := first
+		first = nil
+		if data == nil {
+			var err error
+			data, err = rc.read()
+			if errors.Is(err, protocol.ErrLineTooLong) {
+				_ = rc.write(rpcFailure(nil, errorResponse(protocol.CodeRequestTooLarge)))
+				continue
+			}
+			if err != nil {
+				return
+			}
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		if !json.Valid(data) {
+			_ = rc.write(rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: rpcParseError, Message: "parse error"}, ID: json.RawMessage("null")})
+			continue
+		}
+
+		if data[0] == '[' {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(data, &batch); err != nil || len(batch) == 0 {
+				_ = rc.write(rpcFailure(nil, errorResponse(protocol.CodeInvalidRequest)))
+				continue
+			}
+			var replies []rpcResponse
+			for _, msg := range batch {
+				if reply, _ := s.callRPC(peer, msg, true); reply != nil {
+					replies = append(replies, *reply)
+				}
+			}
+			if len(replies) > 0 {
+				_ = rc.write(replies)
+			}
+			continue
+		}
+
+		reply, sub := s.callRPC(peer, data, false)
+		if reply != nil {
+			_ = rc.write(*reply)
+		}
+		if sub != nil {
+			defer s.unsubscribe(sub)
+			s.stream(rc.conn, sub, func(event []byte) error {
+				return rc.write(rpcNotification{JSONRPC: "2.0", Method: "event", Params: bytes.TrimSpace(event)})
+			})
+			return
+		}
+	}
+}
+
+// callRPC runs one JSON-RPC call. It returns no reply for a notification,
+// and the subscriber when the call subscribed; subscribe is refused inside
+// a batch.
+func (s *Server) callRPC(peer Peer, msg json.RawMessage, batched bool) (*rpcResponse, *subscriber) {
+	var call rpcRequest
+	if err := json.Unmarshal(msg, &call); err != nil || call.JSONRPC != "2.0" || call.Method == "" {
+		reply := rpcFailure(call.ID, errorResponse(protocol.CodeInvalidRequest))
+		return &reply, nil
+	}
+
+	var req Request
+	if len(call.Params) > 0 && string(call.Params) != "null" {
+		if call.Params[0] != '{' || json.Unmarshal(call.Params, &req) != nil {
+			if call.ID == nil {
+				return nil, nil
+			}
+			reply := rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: rpcInvalidParams, Message: "invalid params"}, ID: call.ID}
+			return &reply, nil
+		}
+	}
+	req.Op = call.Method
+	req.ReqID = 0
+	req.Paged = false
+
+	var resp Response
+	var sub *subscriber
+	switch {
+	case !s.allowed(peer, req.Op):
+		resp = errorResponse(protocol.CodeForbidden)
+	case req.Op == "subscribe" && batched:
+		resp = errorResponse(protocol.CodeInvalidRequest)
+	case req.Op == "subscribe":
+		sub, resp = s.subscribe(req)
+	default:
+		resp = s.handleRequest(req)
+	}
+
+	if call.ID == nil {
+		return nil, sub
+	}
+	if !resp.Ok {
+		reply := rpcFailure(call.ID, resp)
+		return &reply, sub
+	}
+	result, err := rpcResult(resp)
+	if err != nil {
+		reply := rpcFailure(call.ID, errorResponse(protocol.CodeInvalidRequest))
+		return &reply, sub
+	}
+	return &rpcResponse{JSONRPC: "2.0", Result: result, ID: call.ID}, sub
+}
+
+// rpcResult is the response without its native envelope members.
+func rpcResult(resp Response) (json.RawMessage, error) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"ok", "req_id", "error", "code", "more"} {
+		delete(members, name)
+	}
+	return json.Marshal(members)
+}
+
+func rpcFailure(id json.RawMessage, resp Response) rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	code, message := rpcServerError, resp.Error
+	switch resp.Code {
+	case protocol.CodeInvalidRequest:
+		// The native message speaks of JSON, which may well be valid here.
+		code, message = rpcInvalidRequest, "invalid request"
+	case protocol.CodeRequestTooLarge:
+		code = rpcInvalidRequest
+	case protocol.CodeUnknownOp:
+		code = rpcMethodNotFound
+	}
+	return rpcResponse{
+		JSONRPC: "2.0",
+		Error:   &rpcError{Code: code, Message: message, Data: &rpcDetail{Code: resp.Code}},
+		ID:      id,
+	}
+}
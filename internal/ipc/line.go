@@ -0,0 +1,37 @@
+package ipc
+
+import "github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
+
+// entryOverhead is counted toward a page for each entry's other fields.
+const entryOverhead = 512
+
+// pages splits a response carrying entries or matches into pages of about
+// protocol.PageBytes of content. Every page but the last has More set; only
+// the first carries the other fields.
+func pages(resp Response) []Response {
+	if !resp.Ok {
+		return []Response{resp}
+	}
+	var out []Response
+	page := resp
+	page.Entries, page.Matches = nil, nil
+	size := 0
+	add := func(content int) {
+		if size > 0 && size+content > protocol.PageBytes {
+			page.More = true
+			out = append(out, page)
+			page = Response{Ok: true, ReqID: resp.ReqID}
+			size = 0
+		}
+		size += content
+	}
+	for _, entry := range resp.Entries {
+		add(len(entry.Content) + entryOverhead)
+		page.Entries = append(page.Entries, entry)
+	}
+	for _, match := range resp.Matches {
+		add(len(match.Entry.Content) + entryOverhead)
+		page.Matches = append(page.Matches, match)
+	}
+	return append(out, page)
+}
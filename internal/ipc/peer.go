@@ -0,0 +1,104 @@
+package ipc
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Peer identifies the process on the other end of a connection. Exe is
+// empty when it cannot be determined.
+type Peer struct {
+	PID int32
+	UID uint32
+	Exe string
+}
+
+func (p Peer) String() string {
+	exe := p.Exe
+	if exe == "" {
+		exe = "unknown"
+	}
+	return fmt.Sprintf("pid=%d exe=%s", p.PID, exe)
+}
+
+// hello and boards reveal no entry content and are always allowed.
+var opGroups = map[string][]string{
+	"read": {"history", "search", "subscribe", "dump", "snippets"},
+	// transform and snippet set the clipboard and may add an entry.
+	"write": {
+		"add", "select", "update", "delete", "pin", "unpin", "clear", "move", "transform", "snippet",
+		"board_create", "board_switch", "board_delete",
+	},
+}
+
+// Policy decides which ops a peer may use. Rules are keyed by the absolute
+// path of the executable, compared exactly, or "*" for every peer no other
+// rule matches. Base names are refused: any sandboxed app can ship a binary
+// called smartpasta-ui.
+type Policy struct {
+	rules map[string]map[string]bool
+}
+
+// NewPolicy builds a policy from lists of op names and the groups "read",
+// "write", "all" and "none"; op names are case-insensitive. Without rules it
+// returns a nil policy, which allows everything.
+func NewPolicy(rules map[string][]string) (*Policy, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	p := &Policy{rules: make(map[string]map[string]bool)}
+	for key, names := range rules {
+		if key != "*" && !filepath.IsAbs(key) {
+			return nil, fmt.Errorf("%s: not an absolute executable path", key)
+		}
+		allowed := make(map[string]bool)
+		for _, name := range names {
+			name = strings.ToLower(name)
+			switch {
+			case name == "all":
+				for _, op := range ops {
+					allowed[op] = true
+				}
+			case name == "none":
+			case opGroups[name] != nil:
+				for _, op := range opGroups[name] {
+					allowed[op] = true
+				}
+			case knownOp(name):
+				allowed[name] = true
+			default:
+				return nil, fmt.Errorf("%s: unknown op %q", key, name)
+			}
+		}
+		if key != "*" {
+			key = filepath.Clean(key)
+		}
+		p.rules[key] = allowed
+	}
+	return p, nil
+}
+
+// Allows reports whether peer may use op. A nil policy allows everything.
+func (p *Policy) Allows(peer Peer, op string) bool {
+	// Unknown ops are let through to get their own error.
+	if p == nil || op == "hello" || op == "boards" || !knownOp(op) {
+		return true
+	}
+	if allowed, ok := p.rules[peer.Exe]; ok && peer.Exe != "" {
+		return allowed[op]
+	}
+	if allowed, ok := p.rules["*"]; ok {
+		return allowed[op]
+	}
+	return false
+}
+
+func knownOp(name string) bool {
+	for _, op := range ops {
+		if op == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package ipc
+
+import (
+	"errors"
+	"net"
+)
+
+func peerOf(conn net.Conn) (Peer, error) {
+	return Peer{}, errors.New("peer credentials not supported")
+}
@@ -2,40 +2,48 @@ package ipc
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
-	"smartpasta/internal/history"
+	"github.com/triiberg/smartpasta/internal/history"
+	"github.com/triiberg/smartpasta/internal/snippet"
+	"github.com/triiberg/smartpasta/internal/transform"
+	"github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
 )
 
-type Request struct {
-	Op      string `json:"op"`
-	ID      int64  `json:"id,omitempty"`
-	Content string `json:"content,omitempty"`
-}
-
-type Response struct {
-	Ok      bool            `json:"ok"`
-	Error   string          `json:"error,omitempty"`
-	Entries []history.Entry `json:"entries,omitempty"`
-}
+// The wire types are defined in pkg/smartpasta/protocol, shared with the
+// client package.
+type (
+	Request  = protocol.Request
+	Response = protocol.Response
+	Hello    = protocol.Hello
+)
 
 type Server struct {
 	listener      net.Listener
 	socketPath    string
-	history       *history.History
+	boards        *history.Boards
+	snippets      *snippet.Library
 	setClipboard  func(string) error
 	logger        func(string, ...any)
+	infof         func(string, ...any)
+	policy        *Policy
 	dumpDirectory string
+	lineLimit     int
+	version       string
+	flavor        string
+	subMu         sync.Mutex
+	subscribers   map[*subscriber]struct{}
 }
 
-func NewServer(socketPath string, dumpDir string, historyStore *history.History, setClipboard func(string) error, logger func(string, ...any)) (*Server, error) {
+func NewServer(socketPath string, dumpDir string, boards *history.Boards, snippets *snippet.Library, setClipboard func(string) error, logger func(string, ...any)) (*Server, error) {
 	if socketPath == "" {
 		return nil, fmt.Errorf("socket path required")
 	}
@@ -55,14 +63,19 @@ func NewServer(socketPath string, dumpDir string, historyStore *history.History,
 		return nil, err
 	}
 
-	return &Server{
+	s := &Server{
 		listener:      listener,
 		socketPath:    socketPath,
-		history:       historyStore,
+		boards:        boards,
+		snippets:      snippets,
 		setClipboard:  setClipboard,
 		logger:        logger,
 		dumpDirectory: dumpDir,
-	}, nil
+		lineLimit:     protocol.LineLimit(boards.MaxBytes()),
+		subscribers:   make(map[*subscriber]struct{}),
+	}
+	boards.Observe(s.notify)
+	return s, nil
 }
 
 func (s *Server) Close() error {
@@ -85,66 +98,312 @@ func (s *Server) Serve() error {
 	}
 }
 
+// SetPolicy restricts the ops each peer may use and logs every connection
+// with infof. A nil policy allows everything.
+func (s *Server) SetPolicy(policy *Policy, infof func(string, ...any)) {
+	s.policy = policy
+	s.infof = infof
+}
+
 func (s *Server) handleConn(conn net.Conn) {
 	defer conn.Close()
 
-	scanner := bufio.NewScanner(conn)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
+	// The socket is only reachable by the owner, but root can still
+	// connect; other users are turned away.
+	peer, err := peerOf(conn)
+	switch {
+	case err != nil:
+		if s.logger != nil {
+			s.logger("peer credentials: %v", err)
+		}
+	case peer.UID != uint32(os.Getuid()):
+		if s.logger != nil {
+			s.logger("rejected connection from uid %d %s", peer.UID, peer)
+		}
+		return
+	}
+	if s.infof != nil {
+		s.infof("connection from %s", peer)
+	}
+
+	reader := bufio.NewReader(conn)
+	// JSON-RPC clients are recognised by their first message: a
+	// Content-Length header, a batch, or an object with "jsonrpc".
+	if first, err := reader.Peek(1); err == nil && (first[0] == 'C' || first[0] == 'c') {
+		s.serveJSONRPC(&rpcConn{conn: conn, reader: reader, framed: true, limit: s.lineLimit}, peer, nil)
+		return
+	}
+	detected := false
+	for {
+		line, err := protocol.ReadLine(reader, s.lineLimit)
+		if errors.Is(err, protocol.ErrLineTooLong) {
+			s.writeResponse(conn, errorResponse(protocol.CodeRequestTooLarge))
 			continue
 		}
+		if err != nil {
+			return
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if !detected && isJSONRPC(line) {
+			s.serveJSONRPC(&rpcConn{conn: conn, reader: reader, limit: s.lineLimit}, peer, line)
+			return
+		}
+
+		detected = true
 
 		var req Request
-		if err := json.Unmarshal([]byte(line), &req); err != nil {
-			s.writeResponse(conn, Response{Ok: false, Error: "invalid json"})
+		if err := json.Unmarshal(line, &req); err != nil {
+			s.writeResponse(conn, errorResponse(protocol.CodeInvalidRequest))
+			continue
+		}
+		if !s.allowed(peer, req.Op) {
+			resp := errorResponse(protocol.CodeForbidden)
+			resp.ReqID = req.ReqID
+			s.writeResponse(conn, resp)
 			continue
 		}
+		if req.Op == "subscribe" {
+			// A subscribed connection only carries events from here on.
+			s.handleSubscribe(conn, req)
+			return
+		}
 
-		s.handleRequest(conn, req)
+		resp := s.handleRequest(req)
+		resp.ReqID = req.ReqID
+		if !req.Paged {
+			s.writeResponse(conn, resp)
+			continue
+		}
+		for _, page := range pages(resp) {
+			s.writeResponse(conn, page)
+		}
 	}
 }
 
-func (s *Server) handleRequest(conn net.Conn, req Request) {
+func (s *Server) allowed(peer Peer, op string) bool {
+	if s.policy.Allows(peer, op) {
+		return true
+	}
+	if s.logger != nil {
+		s.logger("denied op %s to %s", op, peer)
+	}
+	return false
+}
+
+func (s *Server) handleRequest(req Request) Response {
+	switch req.Op {
+	case "hello":
+		return Response{Ok: true, Hello: s.hello()}
+	case "boards", "board_create", "board_switch", "board_delete", "move":
+		return s.handleBoardOp(req)
+	case "snippets":
+		if s.snippets == nil {
+			return Response{Ok: true}
+		}
+		snippets, err := s.snippets.List()
+		if err != nil {
+			if s.logger != nil {
+				s.logger("load snippets failed: %v", err)
+			}
+			return errorResponse(protocol.CodeSnippetsUnavailable)
+		}
+		return Response{Ok: true, Snippets: snippets}
+	}
+
+	store, err := s.boards.Get(req.Board)
+	if err != nil {
+		return errorResponse(protocol.CodeBoardNotFound)
+	}
+
 	switch req.Op {
 	case "history":
-		entries := s.history.ListMRU()
-		s.writeResponse(conn, Response{Ok: true, Entries: entries})
+		return Response{Ok: true, Entries: store.ListMRU()}
+	case "search":
+		matches, total, err := store.Search(history.Query{Text: req.Query, Mode: req.Mode, Limit: req.Limit, Offset: req.Offset})
+		if err != nil {
+			return errorResponse(protocol.CodeInvalidQuery)
+		}
+		return Response{Ok: true, Matches: matches, Total: total}
+	case "add":
+		entry, err := store.AddWithOptions(req.Content, history.AddOptions{Source: req.Source, Pinned: req.Pinned, Sensitive: req.Sensitive})
+		switch {
+		case errors.Is(err, history.ErrTooLarge):
+			return errorResponse(protocol.CodeTooLarge)
+		case err != nil && !errors.Is(err, history.ErrDuplicate):
+			return errorResponse(protocol.CodeInvalidContent)
+		}
+		if req.Clipboard && s.setClipboard != nil {
+			if err := s.setClipboard(entry.Content); err != nil {
+				return errorResponse(protocol.CodeClipboard)
+			}
+		}
+		return Response{Ok: true, Entries: []history.Entry{entry}}
 	case "select":
-		entry, err := s.history.Select(req.ID)
+		entry, err := store.Select(req.ID)
 		if err != nil {
-			s.writeResponse(conn, Response{Ok: false, Error: "not found"})
-			return
+			return errorResponse(protocol.CodeNotFound)
 		}
 		if s.setClipboard != nil {
 			if err := s.setClipboard(entry.Content); err != nil {
-				s.writeResponse(conn, Response{Ok: false, Error: "clipboard error"})
-				return
+				return errorResponse(protocol.CodeClipboard)
 			}
 		}
-		s.writeResponse(conn, Response{Ok: true})
+		return Response{Ok: true}
+	case "update":
+		entry, err := store.Update(req.ID, req.Content)
+		switch {
+		case errors.Is(err, history.ErrTooLarge):
+			return errorResponse(protocol.CodeTooLarge)
+		case errors.Is(err, history.ErrInvalidContent):
+			return errorResponse(protocol.CodeInvalidContent)
+		case err != nil:
+			return errorResponse(protocol.CodeNotFound)
+		}
+		if current := store.ListMRU(); len(current) > 0 && current[0].ID == entry.ID && s.setClipboard != nil {
+			if err := s.setClipboard(entry.Content); err != nil {
+				return errorResponse(protocol.CodeClipboard)
+			}
+		}
+		return Response{Ok: true, Entries: []history.Entry{entry}}
 	case "delete":
-		if err := s.history.Delete(req.ID); err != nil {
-			s.writeResponse(conn, Response{Ok: false, Error: "not found"})
-			return
+		if err := store.Delete(req.ID); err != nil {
+			return errorResponse(protocol.CodeNotFound)
 		}
-		s.writeResponse(conn, Response{Ok: true})
+		return Response{Ok: true}
+	case "pin", "unpin":
+		entry, err := store.SetPinned(req.ID, req.Op == "pin")
+		if err != nil {
+			return errorResponse(protocol.CodeNotFound)
+		}
+		return Response{Ok: true, Entries: []history.Entry{entry}}
 	case "clear":
-		s.history.Clear()
-		s.writeResponse(conn, Response{Ok: true})
+		store.Clear()
+		return Response{Ok: true}
+	case "transform":
+		return s.handleTransform(store, req)
+	case "snippet":
+		return s.handleSnippet(store, req)
 	case "dump":
 		filename := filepath.Join(s.dumpDirectory, dumpFilename(time.Now()))
-		if err := dumpEntries(filename, s.history.ListChronological()); err != nil {
+		if err := dumpEntries(filename, store.ListChronological()); err != nil {
 			if s.logger != nil {
 				s.logger("dump failed: %v", err)
 			}
-			s.writeResponse(conn, Response{Ok: false, Error: "dump failed"})
-			return
+			return errorResponse(protocol.CodeDumpFailed)
+		}
+		return Response{Ok: true}
+	default:
+		return errorResponse(protocol.CodeUnknownOp)
+	}
+}
+
+func (s *Server) handleBoardOp(req Request) Response {
+	var err error
+	switch req.Op {
+	case "boards":
+		return Response{Ok: true, Boards: s.boards.List()}
+	case "board_create":
+		err = s.boards.Create(req.Board)
+	case "board_switch":
+		err = s.boards.Switch(req.Board)
+	case "board_delete":
+		err = s.boards.Delete(req.Board)
+	case "move":
+		var entry history.Entry
+		entry, err = s.boards.Move(req.ID, req.Board, req.To)
+		if err == nil {
+			return Response{Ok: true, Entries: []history.Entry{entry}}
+		}
+	}
+
+	switch {
+	case err == nil:
+		return Response{Ok: true, Boards: s.boards.List()}
+	case errors.Is(err, history.ErrBoardNotFound):
+		return errorResponse(protocol.CodeBoardNotFound)
+	case errors.Is(err, history.ErrBoardExists):
+		return errorResponse(protocol.CodeBoardExists)
+	case errors.Is(err, history.ErrInvalidBoardName):
+		return errorResponse(protocol.CodeInvalidBoardName)
+	case errors.Is(err, history.ErrDefaultBoard):
+		return errorResponse(protocol.CodeDefaultBoard)
+	default:
+		return errorResponse(protocol.CodeNotFound)
+	}
+}
+
+func (s *Server) handleTransform(store *history.History, req Request) Response {
+	entry, err := store.Get(req.ID)
+	if err != nil {
+		return errorResponse(protocol.CodeNotFound)
+	}
+	result, err := transform.Apply(req.Transform, entry.Content)
+	if err != nil {
+		if errors.Is(err, transform.ErrUnknown) {
+			return errorResponse(protocol.CodeUnknownTransform)
+		}
+		return errorResponse(protocol.CodeTransformFailed)
+	}
+	if result == "" {
+		return errorResponse(protocol.CodeEmptyResult)
+	}
+
+	resp := Response{Ok: true, Content: result}
+	switch req.Mode {
+	case "", protocol.TransformModeReplace:
+	case protocol.TransformModeAdd:
+		if added, ok := store.Add(result); ok {
+			resp.Entries = []history.Entry{added}
 		}
-		s.writeResponse(conn, Response{Ok: true})
 	default:
-		s.writeResponse(conn, Response{Ok: false, Error: "unknown op"})
+		return errorResponse(protocol.CodeUnknownMode)
 	}
+
+	if s.setClipboard != nil {
+		if err := s.setClipboard(result); err != nil {
+			return errorResponse(protocol.CodeClipboard)
+		}
+	}
+	return resp
+}
+
+func (s *Server) handleSnippet(store *history.History, req Request) Response {
+	if s.snippets == nil {
+		return errorResponse(protocol.CodeNotFound)
+	}
+	item, err := s.snippets.Get(req.Name)
+	if err != nil {
+		return errorResponse(protocol.CodeNotFound)
+	}
+
+	clipboard := ""
+	if entries := store.ListMRU(); len(entries) > 0 {
+		clipboard = entries[0].Content
+	}
+	expanded, err := snippet.Expand(item.Content, req.Fields, clipboard)
+	if err != nil {
+		if errors.Is(err, snippet.ErrMissingField) {
+			return errorResponse(protocol.CodeMissingField)
+		}
+		return errorResponse(protocol.CodeExpandFailed)
+	}
+	if expanded == "" {
+		return errorResponse(protocol.CodeEmptyResult)
+	}
+
+	resp := Response{Ok: true, Content: expanded}
+	if added, ok := store.Add(expanded); ok {
+		resp.Entries = []history.Entry{added}
+	}
+	if s.setClipboard != nil {
+		if err := s.setClipboard(expanded); err != nil {
+			return errorResponse(protocol.CodeClipboard)
+		}
+	}
+	return resp
 }
 
 func (s *Server) writeResponse(conn net.Conn, resp Response) {
@@ -179,7 +438,14 @@ func dumpFilename(t time.Time) string {
 	return fmt.Sprintf("dump-%s.txt", t.Format("2006-01-02 15:04:05"))
 }
 
-func dumpEntries(path string, entries []history.Entry) error {
+// dumpEntries writes entries to path, leaving out sensitive ones.
+func dumpEntries(path string, all []history.Entry) error {
+	entries := make([]history.Entry, 0, len(all))
+	for _, entry := range all {
+		if !entry.Sensitive {
+			entries = append(entries, entry)
+		}
+	}
 	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
 	if err != nil {
 		return err
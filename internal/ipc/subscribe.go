@@ -0,0 +1,112 @@
+package ipc
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+
+	"github.com/triiberg/smartpasta/internal/history"
+	"github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before it is disconnected.
+const subscriberBuffer = 64
+
+type subscriber struct {
+	board  string
+	events chan []byte
+}
+
+// notify fans a history change out to the subscribers. It never blocks:
+// a subscriber whose buffer is full is dropped.
+func (s *Server) notify(change history.Change) {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	for sub := range s.subscribers {
+		if sub.board != "" && sub.board != change.Board {
+			continue
+		}
+		select {
+		case sub.events <- data:
+		default:
+			delete(s.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// handleSubscribe turns the connection into an event stream. It returns
+// when the client disconnects or falls too far behind.
+func (s *Server) handleSubscribe(conn net.Conn, req Request) {
+	sub, resp := s.subscribe(req)
+	resp.ReqID = req.ReqID
+	s.writeResponse(conn, resp)
+	if sub == nil {
+		return
+	}
+	defer s.unsubscribe(sub)
+
+	s.stream(conn, sub, func(event []byte) error {
+		_, err := conn.Write(event)
+		return err
+	})
+}
+
+// subscribe registers a subscriber for req.Board, or for all boards.
+func (s *Server) subscribe(req Request) (*subscriber, Response) {
+	if req.Board != "" {
+		if _, err := s.boards.Get(req.Board); err != nil {
+			return nil, errorResponse(protocol.CodeBoardNotFound)
+		}
+	}
+	sub := &subscriber{board: req.Board, events: make(chan []byte, subscriberBuffer)}
+	s.subMu.Lock()
+	s.subscribers[sub] = struct{}{}
+	s.subMu.Unlock()
+	return sub, Response{Ok: true}
+}
+
+// stream sends the subscriber's events, newline-terminated JSON shared by
+// all subscribers, until the client goes away, falls too far behind or send
+// fails.
+func (s *Server) stream(conn net.Conn, sub *subscriber, send func(event []byte) error) {
+	// Nothing more is read from a subscribed connection; reading only
+	// detects the client going away.
+	closed := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (s *Server) unsubscribe(sub *subscriber) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	if _, ok := s.subscribers[sub]; ok {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
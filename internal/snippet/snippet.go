@@ -0,0 +1,167 @@
+package snippet
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
+)
+
+const maxSnippetBytes = 1 << 20
+
+var (
+	ErrNotFound     = errors.New("snippet not found")
+	ErrMissingField = errors.New("missing field value")
+)
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-zA-Z]+)(?::([^}]*))?\s*\}\}`)
+
+type Snippet = protocol.Snippet
+
+// Library is a directory of plain-text snippet files. The file name without
+// its extension is the snippet name. The directory is re-read on every call
+// so edits show up without restarting the daemon.
+type Library struct {
+	dir string
+}
+
+func NewLibrary(dir string) *Library {
+	return &Library{dir: dir}
+}
+
+func (l *Library) List() ([]Snippet, error) {
+	dirEntries, err := os.ReadDir(l.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	snippets := make([]Snippet, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || strings.HasPrefix(dirEntry.Name(), ".") || strings.HasSuffix(dirEntry.Name(), "~") {
+			continue
+		}
+		snippet, err := l.load(dirEntry.Name())
+		if err != nil {
+			continue
+		}
+		snippets = append(snippets, snippet)
+	}
+	sort.Slice(snippets, func(i, j int) bool {
+		return snippets[i].Name < snippets[j].Name
+	})
+	return snippets, nil
+}
+
+func (l *Library) Get(name string) (Snippet, error) {
+	snippets, err := l.List()
+	if err != nil {
+		return Snippet{}, err
+	}
+	for _, snippet := range snippets {
+		if snippet.Name == name {
+			return snippet, nil
+		}
+	}
+	return Snippet{}, ErrNotFound
+}
+
+func (l *Library) load(filename string) (Snippet, error) {
+	path := filepath.Join(l.dir, filename)
+	info, err := os.Stat(path)
+	if err != nil {
+		return Snippet{}, err
+	}
+	if !info.Mode().IsRegular() || info.Size() > maxSnippetBytes {
+		return Snippet{}, fmt.Errorf("skip %s", filename)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Snippet{}, err
+	}
+	content := strings.TrimSuffix(string(data), "\n")
+	return Snippet{
+		Name:    strings.TrimSuffix(filename, filepath.Ext(filename)),
+		Content: content,
+		Fields:  Fields(content),
+	}, nil
+}
+
+// Fields returns the prompted field labels of a snippet in order of first
+// appearance. Prompted fields are written as {{input:Label}}.
+func Fields(content string) []string {
+	var fields []string
+	seen := make(map[string]struct{})
+	for _, match := range placeholderPattern.FindAllStringSubmatch(content, -1) {
+		if match[1] != "input" {
+			continue
+		}
+		label := strings.TrimSpace(match[2])
+		if _, ok := seen[label]; ok {
+			continue
+		}
+		seen[label] = struct{}{}
+		fields = append(fields, label)
+	}
+	return fields
+}
+
+// Expand replaces placeholders in content. Supported placeholders are
+// {{date}}, {{time}}, {{datetime}}, {{clipboard}}, {{uuid}} and prompted
+// {{input:Label}} fields taken from values. Unknown placeholders are kept.
+func Expand(content string, values map[string]string, clipboard string) (string, error) {
+	now := time.Now()
+	var expandErr error
+	expanded := placeholderPattern.ReplaceAllStringFunc(content, func(placeholder string) string {
+		match := placeholderPattern.FindStringSubmatch(placeholder)
+		switch match[1] {
+		case "date":
+			return now.Format("2006-01-02")
+		case "time":
+			return now.Format("15:04:05")
+		case "datetime":
+			return now.Format("2006-01-02 15:04:05")
+		case "clipboard":
+			return clipboard
+		case "uuid":
+			id, err := newUUID()
+			if err != nil {
+				expandErr = err
+				return placeholder
+			}
+			return id
+		case "input":
+			value, ok := values[strings.TrimSpace(match[2])]
+			if !ok {
+				expandErr = ErrMissingField
+				return placeholder
+			}
+			return value
+		default:
+			return placeholder
+		}
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	return expanded, nil
+}
+
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,122 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrUnknown = errors.New("unknown transform")
+	// ErrNotText is returned when decoding gives bytes that are not UTF-8,
+	// which cannot be a text entry.
+	ErrNotText = errors.New("decoded data is not text")
+)
+
+type Transform struct {
+	Name  string
+	Label string
+	apply func(string) (string, error)
+}
+
+var transforms = []Transform{
+	{Name: "trim", Label: "Trim whitespace", apply: trim},
+	{Name: "strip-newline", Label: "Strip trailing newline", apply: stripNewline},
+	{Name: "upper", Label: "UPPER CASE", apply: upper},
+	{Name: "lower", Label: "lower case", apply: lower},
+	{Name: "url-encode", Label: "URL encode", apply: urlEncode},
+	{Name: "url-decode", Label: "URL decode", apply: urlDecode},
+	{Name: "base64-encode", Label: "Base64 encode", apply: base64Encode},
+	{Name: "base64-decode", Label: "Base64 decode", apply: base64Decode},
+	{Name: "json-pretty", Label: "JSON pretty-print", apply: jsonPretty},
+	{Name: "json-minify", Label: "JSON minify", apply: jsonMinify},
+	{Name: "shell-escape", Label: "Escape for shell", apply: shellEscape},
+}
+
+func List() []Transform {
+	list := make([]Transform, len(transforms))
+	copy(list, transforms)
+	return list
+}
+
+func Apply(name string, content string) (string, error) {
+	for _, t := range transforms {
+		if t.Name == name {
+			return t.apply(content)
+		}
+	}
+	return "", ErrUnknown
+}
+
+func trim(content string) (string, error) {
+	return strings.TrimSpace(content), nil
+}
+
+func stripNewline(content string) (string, error) {
+	content = strings.TrimSuffix(content, "\n")
+	return strings.TrimSuffix(content, "\r"), nil
+}
+
+func upper(content string) (string, error) {
+	return strings.ToUpper(content), nil
+}
+
+func lower(content string) (string, error) {
+	return strings.ToLower(content), nil
+}
+
+func urlEncode(content string) (string, error) {
+	return url.QueryEscape(content), nil
+}
+
+func urlDecode(content string) (string, error) {
+	decoded, err := url.QueryUnescape(content)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.ValidString(decoded) {
+		return "", ErrNotText
+	}
+	return decoded, nil
+}
+
+func base64Encode(content string) (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(content)), nil
+}
+
+func base64Decode(content string) (string, error) {
+	trimmed := strings.TrimSpace(content)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if decoded, err := enc.DecodeString(trimmed); err == nil {
+			if !utf8.Valid(decoded) {
+				return "", ErrNotText
+			}
+			return string(decoded), nil
+		}
+	}
+	return "", errors.New("invalid base64")
+}
+
+func jsonPretty(content string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(strings.TrimSpace(content)), "", "  "); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func jsonMinify(content string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(strings.TrimSpace(content))); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func shellEscape(content string) (string, error) {
+	return "'" + strings.ReplaceAll(content, "'", `'\''`) + "'", nil
+}
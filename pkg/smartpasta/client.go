@@ -0,0 +1,534 @@
+// Package smartpasta is a client for the smartpasta-daemon IPC protocol.
+// It is used by smartpasta-ui and smartpasta-ctl and can be imported by
+// other tools.
+package smartpasta
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
+)
+
+// Protocol types, defined in package protocol and shared with the daemon.
+type (
+	Entry     = protocol.Entry
+	Match     = protocol.Match
+	Query     = protocol.Query
+	BoardInfo = protocol.BoardInfo
+	Change    = protocol.Change
+	Snippet   = protocol.Snippet
+	Request   = protocol.Request
+	Response  = protocol.Response
+	Hello     = protocol.Hello
+)
+
+const (
+	DefaultBoard = protocol.DefaultBoard
+
+	SearchSubstring       = protocol.SearchSubstring
+	SearchCaseInsensitive = protocol.SearchCaseInsensitive
+	SearchFuzzy           = protocol.SearchFuzzy
+	SearchRegex           = protocol.SearchRegex
+
+	TransformReplace = protocol.TransformModeReplace
+	TransformAdd     = protocol.TransformModeAdd
+
+	ChangeAdded    = protocol.ChangeAdded
+	ChangeSelected = protocol.ChangeSelected
+	ChangeUpdated  = protocol.ChangeUpdated
+	ChangeDeleted  = protocol.ChangeDeleted
+	ChangeCleared  = protocol.ChangeCleared
+
+	ChangeBoardDeleted = protocol.ChangeBoardDeleted
+
+	ProtocolVersion = protocol.Version
+)
+
+// Error codes reported by the daemon; see Error.
+const (
+	CodeInvalidRequest      = protocol.CodeInvalidRequest
+	CodeRequestTooLarge     = protocol.CodeRequestTooLarge
+	CodeUnknownOp           = protocol.CodeUnknownOp
+	CodeForbidden           = protocol.CodeForbidden
+	CodeNotFound            = protocol.CodeNotFound
+	CodeBoardNotFound       = protocol.CodeBoardNotFound
+	CodeBoardExists         = protocol.CodeBoardExists
+	CodeInvalidBoardName    = protocol.CodeInvalidBoardName
+	CodeDefaultBoard        = protocol.CodeDefaultBoard
+	CodeInvalidContent      = protocol.CodeInvalidContent
+	CodeTooLarge            = protocol.CodeTooLarge
+	CodeInvalidQuery        = protocol.CodeInvalidQuery
+	CodeClipboard           = protocol.CodeClipboard
+	CodeUnknownTransform    = protocol.CodeUnknownTransform
+	CodeTransformFailed     = protocol.CodeTransformFailed
+	CodeUnknownMode         = protocol.CodeUnknownMode
+	CodeEmptyResult         = protocol.CodeEmptyResult
+	CodeMissingField        = protocol.CodeMissingField
+	CodeExpandFailed        = protocol.CodeExpandFailed
+	CodeSnippetsUnavailable = protocol.CodeSnippetsUnavailable
+	CodeDumpFailed          = protocol.CodeDumpFailed
+)
+
+const (
+	dialTimeout = 500 * time.Millisecond
+	// DefaultTimeout bounds a request whose context has no earlier deadline.
+	DefaultTimeout = 5 * time.Second
+)
+
+// ErrUnavailable is returned when the daemon cannot be reached.
+var ErrUnavailable = errors.New("smartpasta daemon unavailable")
+
+// Error is a request the daemon answered with ok=false.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// IsCode reports whether err is a daemon error with the given code.
+func IsCode(err error, code string) bool {
+	var daemonErr *Error
+	return errors.As(err, &daemonErr) && daemonErr.Code == code
+}
+
+// Client is a connection to the daemon. Requests are answered in order; a
+// Client must not be used from several goroutines at once. When the
+// connection breaks, for example because the daemon restarted, the next
+// request dials again.
+type Client struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writer     *bufio.Writer
+	socketPath string
+	// Board is sent with entry operations that name no board; empty means
+	// the daemon's active board.
+	Board string
+	// Timeout bounds each request in addition to its context; zero means
+	// no limit.
+	Timeout time.Duration
+	lastID  uint64
+	hello   *Hello
+	// lineLimit bounds a response line; it grows when the daemon accepts
+	// larger entries than the default.
+	lineLimit int
+}
+
+// DefaultSocketPath returns the daemon socket path
+// (~/.cache/smartpasta/smartpasta.sock by default).
+func DefaultSocketPath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		cacheDir = filepath.Join(homeDir, ".cache")
+	}
+	return filepath.Join(cacheDir, "smartpasta", "smartpasta.sock"), nil
+}
+
+// Dial connects to the daemon at socketPath, or at DefaultSocketPath when
+// it is empty, and asks it for its version and limits.
+func Dial(ctx context.Context, socketPath string) (*Client, error) {
+	if socketPath == "" {
+		path, err := DefaultSocketPath()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		socketPath = path
+	}
+	c := &Client{socketPath: socketPath, Timeout: DefaultTimeout, lineLimit: protocol.LineLimit(protocol.DefaultMaxBytes)}
+	if err := c.connect(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := c.Hello(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func dial(ctx context.Context, socketPath string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return conn, nil
+}
+
+func (c *Client) connect(ctx context.Context) error {
+	conn, err := dial(ctx, c.socketPath)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	c.writer = bufio.NewWriter(conn)
+	return nil
+}
+
+// disconnect drops a connection that can no longer be trusted to be in
+// step with the daemon.
+func (c *Client) disconnect() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Do sends one request and reads its response. A response with ok=false
+// is returned as an *Error.
+func (c *Client) Do(ctx context.Context, req Request) (Response, error) {
+	var resp Response
+	if req.Board == "" {
+		req.Board = c.Board
+	}
+	c.lastID++
+	req.ReqID = c.lastID
+	data, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+	line, err := c.roundTrip(ctx, append(data, '\n'))
+	if err != nil {
+		return resp, err
+	}
+	if err := c.decode(line, req.ReqID, &resp); err != nil {
+		return resp, err
+	}
+	for page := resp; page.More; {
+		line, err := c.readLine(ctx)
+		if err != nil {
+			return resp, err
+		}
+		page = Response{}
+		if err := c.decode(line, req.ReqID, &page); err != nil {
+			return resp, err
+		}
+		resp.Entries = append(resp.Entries, page.Entries...)
+		resp.Matches = append(resp.Matches, page.Matches...)
+	}
+	resp.More = false
+	if !resp.Ok {
+		code := resp.Code
+		if code == "" {
+			code = protocol.ErrorCode(resp.Error)
+		}
+		return resp, &Error{Code: code, Message: resp.Error}
+	}
+	return resp, nil
+}
+
+// decode parses one response line and checks that it answers reqID.
+// Daemons that predate request IDs do not echo them.
+func (c *Client) decode(line []byte, reqID uint64, resp *Response) error {
+	if err := json.Unmarshal(line, resp); err != nil {
+		c.disconnect()
+		return err
+	}
+	if resp.ReqID != 0 && resp.ReqID != reqID {
+		c.disconnect()
+		return errors.New("response out of order")
+	}
+	return nil
+}
+
+// Hello returns the daemon's version and the ops it supports. A daemon
+// that predates the hello op is reported as protocol 0 with no ops listed.
+// The answer is cached for the life of the client.
+func (c *Client) Hello(ctx context.Context) (*Hello, error) {
+	if c.hello != nil {
+		return c.hello, nil
+	}
+	resp, err := c.Do(ctx, Request{Op: "hello"})
+	switch {
+	case IsCode(err, CodeUnknownOp):
+		c.hello = &Hello{}
+	case err != nil:
+		return nil, err
+	case resp.Hello == nil:
+		return nil, errors.New("empty response")
+	default:
+		c.hello = resp.Hello
+		if resp.Hello.MaxBytes > protocol.DefaultMaxBytes {
+			c.lineLimit = protocol.LineLimit(resp.Hello.MaxBytes)
+		}
+	}
+	return c.hello, nil
+}
+
+// Supports reports whether the daemon handles op. Against a daemon that
+// predates the hello op it reports true, leaving the request itself to
+// fail.
+func (c *Client) Supports(ctx context.Context, op string) bool {
+	hello, err := c.Hello(ctx)
+	if err != nil || hello.Protocol == 0 {
+		return true
+	}
+	for _, name := range hello.Ops {
+		if name == op {
+			return true
+		}
+	}
+	return false
+}
+
+// roundTrip writes one request line and reads the first response line. A request
+// that could not be written on an existing connection never reached the
+// daemon, so it is sent again once on a fresh connection.
+func (c *Client) roundTrip(ctx context.Context, data []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	redialed := false
+	if c.conn == nil {
+		if err := c.connect(ctx); err != nil {
+			return nil, err
+		}
+		redialed = true
+	}
+	err := c.write(ctx, data)
+	if err != nil && !redialed && ctx.Err() == nil {
+		c.disconnect()
+		if err := c.connect(ctx); err != nil {
+			return nil, err
+		}
+		err = c.write(ctx, data)
+	}
+	if err != nil {
+		return nil, c.fail(ctx, err)
+	}
+	return c.readLine(ctx)
+}
+
+func (c *Client) write(ctx context.Context, data []byte) error {
+	stop := c.watch(ctx)
+	defer stop()
+	if _, err := c.writer.Write(data); err != nil {
+		return err
+	}
+	return c.writer.Flush()
+}
+
+func (c *Client) readLine(ctx context.Context) ([]byte, error) {
+	stop := c.watch(ctx)
+	defer stop()
+	line, err := protocol.ReadLine(c.reader, c.lineLimit)
+	if err != nil {
+		if errors.Is(err, protocol.ErrLineTooLong) {
+			err = errors.New("response too large")
+		}
+		return nil, c.fail(ctx, err)
+	}
+	return line, nil
+}
+
+// watch applies the context and the client timeout to the connection. The
+// returned function must be called once the request is done.
+func (c *Client) watch(ctx context.Context) func() bool {
+	conn := c.conn
+	deadline, ok := ctx.Deadline()
+	if c.Timeout > 0 {
+		if limit := time.Now().Add(c.Timeout); !ok || limit.Before(deadline) {
+			deadline, ok = limit, true
+		}
+	}
+	if ok {
+		_ = conn.SetDeadline(deadline)
+	} else {
+		_ = conn.SetDeadline(time.Time{})
+	}
+	return context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+}
+
+// fail drops the connection after an I/O error, which may have left half
+// a request or response on it, and reports the context's error if that is
+// what interrupted it.
+func (c *Client) fail(ctx context.Context, err error) error {
+	c.disconnect()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func (c *Client) History(ctx context.Context) ([]Entry, error) {
+	resp, err := c.Do(ctx, Request{Op: "history", Paged: true})
+	return resp.Entries, err
+}
+
+// Get returns one entry of the board by ID.
+func (c *Client) Get(ctx context.Context, id int64) (Entry, error) {
+	entries, err := c.History(ctx)
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return Entry{}, &Error{Code: CodeNotFound, Message: "not found"}
+}
+
+// Search returns one page of matches and the total number of matches.
+func (c *Client) Search(ctx context.Context, query Query) ([]Match, int, error) {
+	resp, err := c.Do(ctx, Request{Op: "search", Paged: true, Query: query.Text, Mode: query.Mode, Limit: query.Limit, Offset: query.Offset})
+	return resp.Matches, resp.Total, err
+}
+
+// Select moves an entry to the top and makes it the clipboard.
+func (c *Client) Select(ctx context.Context, id int64) error {
+	_, err := c.Do(ctx, Request{Op: "select", ID: id})
+	return err
+}
+
+// AddOptions controls how Add records content.
+type AddOptions struct {
+	// Clipboard also makes the content the current clipboard.
+	Clipboard bool
+	Pinned    bool
+	Sensitive bool
+	// Source names the application the content came from.
+	Source string
+}
+
+// Add records content as a new entry. Content equal to the newest entry is
+// not added twice; that entry is returned instead.
+func (c *Client) Add(ctx context.Context, content string, opts AddOptions) (Entry, error) {
+	resp, err := c.Do(ctx, Request{
+		Op:        "add",
+		Content:   content,
+		Clipboard: opts.Clipboard,
+		Pinned:    opts.Pinned,
+		Sensitive: opts.Sensitive,
+		Source:    opts.Source,
+	})
+	return firstEntry(resp, err)
+}
+
+func (c *Client) Update(ctx context.Context, id int64, content string) (Entry, error) {
+	return firstEntry(c.Do(ctx, Request{Op: "update", ID: id, Content: content}))
+}
+
+func (c *Client) Delete(ctx context.Context, id int64) error {
+	_, err := c.Do(ctx, Request{Op: "delete", ID: id})
+	return err
+}
+
+// Clear removes all entries of the board except pinned ones.
+func (c *Client) Clear(ctx context.Context) error {
+	_, err := c.Do(ctx, Request{Op: "clear"})
+	return err
+}
+
+func (c *Client) SetPinned(ctx context.Context, id int64, pinned bool) (Entry, error) {
+	op := "unpin"
+	if pinned {
+		op = "pin"
+	}
+	return firstEntry(c.Do(ctx, Request{Op: op, ID: id}))
+}
+
+// Transform applies a named transform to an entry and puts the result on
+// the clipboard. With TransformAdd the result is also added as a new entry.
+func (c *Client) Transform(ctx context.Context, id int64, name string, mode string) (string, error) {
+	resp, err := c.Do(ctx, Request{Op: "transform", ID: id, Transform: name, Mode: mode})
+	return resp.Content, err
+}
+
+func (c *Client) Snippets(ctx context.Context) ([]Snippet, error) {
+	resp, err := c.Do(ctx, Request{Op: "snippets"})
+	return resp.Snippets, err
+}
+
+// ExpandSnippet expands a snippet with the given field values, adds the
+// result to the board and puts it on the clipboard.
+func (c *Client) ExpandSnippet(ctx context.Context, name string, fields map[string]string) (string, error) {
+	resp, err := c.Do(ctx, Request{Op: "snippet", Name: name, Fields: fields})
+	return resp.Content, err
+}
+
+// Dump asks the daemon to write the board to a dump file.
+func (c *Client) Dump(ctx context.Context) error {
+	_, err := c.Do(ctx, Request{Op: "dump"})
+	return err
+}
+
+func (c *Client) Boards(ctx context.Context) ([]BoardInfo, error) {
+	resp, err := c.Do(ctx, Request{Op: "boards"})
+	return resp.Boards, err
+}
+
+func (c *Client) CreateBoard(ctx context.Context, name string) error {
+	_, err := c.Do(ctx, Request{Op: "board_create", Board: name})
+	return err
+}
+
+// SwitchBoard makes name the daemon's active board and the client's board.
+func (c *Client) SwitchBoard(ctx context.Context, name string) error {
+	if _, err := c.Do(ctx, Request{Op: "board_switch", Board: name}); err != nil {
+		return err
+	}
+	c.Board = name
+	return nil
+}
+
+func (c *Client) DeleteBoard(ctx context.Context, name string) error {
+	_, err := c.Do(ctx, Request{Op: "board_delete", Board: name})
+	return err
+}
+
+// Move moves an entry from the client's board to another board.
+func (c *Client) Move(ctx context.Context, id int64, to string) (Entry, error) {
+	return firstEntry(c.Do(ctx, Request{Op: "move", ID: id, To: to}))
+}
+
+// ActiveBoard returns the name of the daemon's active board.
+func (c *Client) ActiveBoard(ctx context.Context) (string, error) {
+	boards, err := c.Boards(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, info := range boards {
+		if info.Active {
+			return info.Name, nil
+		}
+	}
+	return DefaultBoard, nil
+}
+
+func firstEntry(resp Response, err error) (Entry, error) {
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(resp.Entries) == 0 {
+		return Entry{}, errors.New("empty response")
+	}
+	return resp.Entries[0], nil
+}
@@ -0,0 +1,463 @@
+package smartpasta
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/triiberg/smartpasta/internal/history"
+	"github.com/triiberg/smartpasta/internal/ipc"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// startDaemon runs an in-process ipc.Server on a temp socket and returns a
+// client connected to it.
+func startDaemon(t *testing.T, maxBytes int) (*Client, *history.Boards) {
+	t.Helper()
+	dir := t.TempDir()
+	boards := history.NewBoards(20, maxBytes)
+	server, err := ipc.NewServer(filepath.Join(dir, "s.sock"), filepath.Join(dir, "dump"), boards, nil, func(string) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.SetVersion("test", "stable")
+	go server.Serve()
+	t.Cleanup(func() { server.Close() })
+
+	c, err := Dial(context.Background(), filepath.Join(dir, "s.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, boards
+}
+
+// fakeDaemon answers requests with scripted lines. reply gets the index of
+// the connection and the request; close makes the connection end after the
+// reply is written.
+type fakeDaemon struct {
+	path     string
+	mu       sync.Mutex
+	requests []string
+	conns    int
+}
+
+type fakeReply func(conn int, req Request) (lines []string, close bool)
+
+func startFake(t *testing.T, reply fakeReply) *fakeDaemon {
+	t.Helper()
+	f := &fakeDaemon{path: filepath.Join(t.TempDir(), "f.sock")}
+	listener, err := net.Listen("unix", f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			index := f.conns
+			f.conns++
+			f.mu.Unlock()
+			go f.serve(conn, index, reply)
+		}
+	}()
+	return f
+}
+
+func (f *fakeDaemon) serve(conn net.Conn, index int, reply fakeReply) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.requests = append(f.requests, scanner.Text())
+		f.mu.Unlock()
+		lines, done := reply(index, req)
+		for _, line := range lines {
+			if _, err := conn.Write([]byte(line + "\n")); err != nil {
+				return
+			}
+		}
+		if done {
+			return
+		}
+	}
+}
+
+func (f *fakeDaemon) counts() (conns int, requests int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns, len(f.requests)
+}
+
+func ok(req Request, body string) string {
+	if body != "" {
+		body = "," + body
+	}
+	data, _ := json.Marshal(req.ReqID)
+	return `{"ok":true,"req_id":` + string(data) + body + `}`
+}
+
+func helloReply(req Request) string {
+	return ok(req, `"hello":{"protocol":1,"version":"fake","max_bytes":1024,"ops":[],"capabilities":[]}`)
+}
+
+func TestTypedMethods(t *testing.T) {
+	ctx := context.Background()
+	c, _ := startDaemon(t, 0)
+
+	hello, err := c.Hello(ctx)
+	if err != nil || hello.Protocol != ProtocolVersion || hello.Version != "test" {
+		t.Fatalf("Hello = %+v, %v", hello, err)
+	}
+	if !c.Supports(ctx, "add") || c.Supports(ctx, "frobnicate") {
+		t.Fatal("Supports does not follow the hello ops")
+	}
+
+	first, err := c.Add(ctx, "first", AddOptions{Source: "test"})
+	if err != nil || first.Content != "first" || first.Source != "test" {
+		t.Fatalf("Add = %+v, %v", first, err)
+	}
+	second, err := c.Add(ctx, "second", AddOptions{Sensitive: true})
+	if err != nil || !second.Sensitive {
+		t.Fatalf("Add sensitive = %+v, %v", second, err)
+	}
+	if again, err := c.Add(ctx, "second", AddOptions{}); err != nil || again.ID != second.ID || !again.Sensitive {
+		t.Fatalf("duplicate Add = %+v, %v; want entry %d unchanged", again, err, second.ID)
+	}
+	if again, err := c.Add(ctx, "second", AddOptions{Pinned: true}); err != nil || again.ID != second.ID || !again.Pinned || !again.Sensitive {
+		t.Fatalf("duplicate pinned Add = %+v, %v; want entry %d pinned", again, err, second.ID)
+	}
+	if _, err := c.SetPinned(ctx, second.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Add(ctx, "", AddOptions{}); !IsCode(err, CodeInvalidContent) {
+		t.Fatalf("empty Add error = %v", err)
+	}
+
+	entries, err := c.History(ctx)
+	if err != nil || len(entries) != 2 || entries[0].ID != second.ID {
+		t.Fatalf("History = %+v, %v", entries, err)
+	}
+	if got, err := c.Get(ctx, first.ID); err != nil || got.Content != "first" {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+	if _, err := c.Get(ctx, 999); !IsCode(err, CodeNotFound) {
+		t.Fatalf("Get missing error = %v", err)
+	}
+	matches, total, err := c.Search(ctx, Query{Text: "fir", Mode: SearchSubstring})
+	if err != nil || total != 1 || matches[0].Entry.ID != first.ID {
+		t.Fatalf("Search = %+v, %d, %v", matches, total, err)
+	}
+
+	if err := c.Select(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := c.Update(ctx, first.ID, "edited")
+	if err != nil || updated.Content != "edited" || updated.EditedAt == nil {
+		t.Fatalf("Update = %+v, %v", updated, err)
+	}
+	if _, err := c.Update(ctx, first.ID, strings.Repeat("x", 1<<20+1)); !IsCode(err, CodeTooLarge) {
+		t.Fatalf("Update with oversize content = %v, want too_large", err)
+	}
+	if result, err := c.Transform(ctx, first.ID, "upper", TransformReplace); err != nil || result != "EDITED" {
+		t.Fatalf("Transform = %q, %v", result, err)
+	}
+	pinned, err := c.SetPinned(ctx, first.ID, true)
+	if err != nil || !pinned.Pinned {
+		t.Fatalf("SetPinned = %+v, %v", pinned, err)
+	}
+	if err := c.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := c.History(ctx); len(entries) != 1 || entries[0].ID != first.ID {
+		t.Fatalf("History after Clear = %+v; want only the pinned entry", entries)
+	}
+	if err := c.Delete(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, first.ID); !IsCode(err, CodeNotFound) {
+		t.Fatalf("second Delete error = %v", err)
+	}
+
+	if err := c.CreateBoard(ctx, "work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateBoard(ctx, "work"); !IsCode(err, CodeBoardExists) {
+		t.Fatalf("duplicate CreateBoard error = %v", err)
+	}
+	moved, err := c.Add(ctx, "to move", AddOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := c.Move(ctx, moved.ID, "work"); err != nil || entry.ID != moved.ID {
+		t.Fatalf("Move = %+v, %v", entry, err)
+	}
+	if err := c.SwitchBoard(ctx, "work"); err != nil || c.Board != "work" {
+		t.Fatalf("SwitchBoard: board %q, %v", c.Board, err)
+	}
+	if active, err := c.ActiveBoard(ctx); err != nil || active != "work" {
+		t.Fatalf("ActiveBoard = %q, %v", active, err)
+	}
+	if entries, _ := c.History(ctx); len(entries) != 1 || entries[0].ID != moved.ID {
+		t.Fatalf("History of work = %+v", entries)
+	}
+	if err := c.SwitchBoard(ctx, DefaultBoard); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteBoard(ctx, "work"); err != nil {
+		t.Fatal(err)
+	}
+	boards, err := c.Boards(ctx)
+	if err != nil || len(boards) != 1 || boards[0].Name != DefaultBoard {
+		t.Fatalf("Boards = %+v, %v", boards, err)
+	}
+	if snippets, err := c.Snippets(ctx); err != nil || len(snippets) != 0 {
+		t.Fatalf("Snippets = %+v, %v", snippets, err)
+	}
+}
+
+func TestAddToPinnedHistory(t *testing.T) {
+	ctx := context.Background()
+	c, _ := startDaemon(t, 0)
+	for i := 0; i < 20; i++ {
+		if _, err := c.Add(ctx, fmt.Sprint("pinned ", i), AddOptions{Pinned: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entry, err := c.Add(ctx, "new", AddOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := c.History(ctx)
+	if err != nil || len(entries) != 21 || entries[0].ID != entry.ID {
+		t.Fatalf("History has %d entries, newest %+v, %v; want the new entry on top of 20 pinned ones", len(entries), entries[0], err)
+	}
+}
+
+// TestRequestsGolden pins down the wire format of every typed method.
+func TestRequestsGolden(t *testing.T) {
+	ctx := context.Background()
+	entry := `"entries":[{"id":1,"content":"x","created_at":"2026-01-01T00:00:00Z"}]`
+	fake := startFake(t, func(_ int, req Request) ([]string, bool) {
+		switch req.Op {
+		case "hello":
+			return []string{helloReply(req)}, false
+		case "add", "update", "pin", "unpin", "move", "history":
+			return []string{ok(req, entry)}, false
+		}
+		return []string{ok(req, "")}, false
+	})
+	c, err := Dial(ctx, fake.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Board = "work"
+
+	_, _ = c.History(ctx)
+	_, _ = c.Get(ctx, 1)
+	_, _, _ = c.Search(ctx, Query{Text: "q", Mode: SearchFuzzy, Limit: 5, Offset: 10})
+	_ = c.Select(ctx, 1)
+	_, _ = c.Add(ctx, "x", AddOptions{Clipboard: true, Pinned: true, Sensitive: true, Source: "test"})
+	_, _ = c.Update(ctx, 1, "y")
+	_ = c.Delete(ctx, 1)
+	_ = c.Clear(ctx)
+	_, _ = c.SetPinned(ctx, 1, true)
+	_, _ = c.SetPinned(ctx, 1, false)
+	_, _ = c.Transform(ctx, 1, "upper", TransformAdd)
+	_, _ = c.Snippets(ctx)
+	_, _ = c.ExpandSnippet(ctx, "sig", map[string]string{"Name": "Ann", "City": "Oslo"})
+	_ = c.Dump(ctx)
+	_, _ = c.Boards(ctx)
+	_ = c.CreateBoard(ctx, "new")
+	_, _ = c.Move(ctx, 1, "new")
+	_ = c.DeleteBoard(ctx, "new")
+	_ = c.SwitchBoard(ctx, "new")
+
+	fake.mu.Lock()
+	got := strings.Join(fake.requests, "\n") + "\n"
+	fake.mu.Unlock()
+	golden := filepath.Join("testdata", "requests.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("requests differ from %s (run with -update to accept)\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
+
+func TestPagedHistory(t *testing.T) {
+	ctx := context.Background()
+	c, _ := startDaemon(t, 1<<20)
+
+	// Quotes and control characters make the JSON much larger than the
+	// content, so every entry needs a page of its own.
+	var added []Entry
+	for i := 0; i < 4; i++ {
+		content := strings.Repeat(string(rune('a'+i))+"\"\x01", 300<<10)
+		entry, err := c.Add(ctx, content, AddOptions{})
+		if err != nil {
+			t.Fatalf("Add %d: %v", i, err)
+		}
+		added = append(added, entry)
+	}
+	entries, err := c.History(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(added) {
+		t.Fatalf("History returned %d entries, want %d", len(entries), len(added))
+	}
+	for i, entry := range entries {
+		want := added[len(added)-1-i]
+		if entry.ID != want.ID || entry.Content != want.Content {
+			t.Fatalf("entry %d = %d, want %d", i, entry.ID, want.ID)
+		}
+	}
+}
+
+func TestDoJoinsPages(t *testing.T) {
+	ctx := context.Background()
+	fake := startFake(t, func(_ int, req Request) ([]string, bool) {
+		if req.Op == "hello" {
+			return []string{helloReply(req)}, false
+		}
+		if !req.Paged {
+			return []string{ok(req, `"entries":[]`)}, false
+		}
+		return []string{
+			ok(req, `"total":3,"more":true,"entries":[{"id":3,"content":"c"}]`),
+			ok(req, `"more":true,"entries":[{"id":2,"content":"b"}]`),
+			ok(req, `"entries":[{"id":1,"content":"a"}]`),
+		}, false
+	})
+	c, err := Dial(ctx, fake.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	resp, err := c.Do(ctx, Request{Op: "history", Paged: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.More || resp.Total != 3 || len(resp.Entries) != 3 || resp.Entries[2].ID != 1 {
+		t.Fatalf("joined response = %+v", resp)
+	}
+	// The connection is still in step after the pages.
+	if _, err := c.Boards(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReqIDMismatch(t *testing.T) {
+	ctx := context.Background()
+	fake := startFake(t, func(conn int, req Request) ([]string, bool) {
+		if req.Op == "hello" {
+			return []string{helloReply(req)}, false
+		}
+		if conn == 0 {
+			req.ReqID += 100
+		}
+		return []string{ok(req, "")}, false
+	})
+	c, err := Dial(ctx, fake.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Clear(ctx); err == nil || !strings.Contains(err.Error(), "out of order") {
+		t.Fatalf("Clear error = %v, want out of order", err)
+	}
+	// The out-of-step connection was dropped; the next request dials anew.
+	if err := c.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if conns, _ := fake.counts(); conns != 2 {
+		t.Fatalf("%d connections, want 2", conns)
+	}
+}
+
+func TestRedialOnce(t *testing.T) {
+	ctx := context.Background()
+	dropped := make(chan struct{})
+	fake := startFake(t, func(conn int, req Request) ([]string, bool) {
+		if req.Op == "hello" && conn == 0 {
+			defer close(dropped)
+			return []string{helloReply(req)}, true
+		}
+		return []string{ok(req, "")}, false
+	})
+	c, err := Dial(ctx, fake.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-dropped
+
+	// The first connection is gone, as after a daemon restart: writing to
+	// it fails and the request goes out once on a new connection.
+	if err := c.Clear(ctx); err != nil {
+		t.Fatalf("Clear after restart: %v", err)
+	}
+	conns, requests := fake.counts()
+	if conns != 2 || requests != 2 {
+		t.Fatalf("%d connections and %d requests, want 2 and 2", conns, requests)
+	}
+}
+
+func TestNoRetryAfterWrite(t *testing.T) {
+	ctx := context.Background()
+	fake := startFake(t, func(conn int, req Request) ([]string, bool) {
+		if req.Op == "hello" {
+			return []string{helloReply(req)}, false
+		}
+		// The request arrived but the daemon went away before answering;
+		// sending it again could apply it twice.
+		return nil, true
+	})
+	c, err := Dial(ctx, fake.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Clear(ctx); err == nil {
+		t.Fatal("Clear succeeded without a response")
+	}
+	if conns, requests := fake.counts(); conns != 1 || requests != 2 {
+		t.Fatalf("%d connections and %d requests, want 1 and 2", conns, requests)
+	}
+}
+
+func TestDialUnavailable(t *testing.T) {
+	_, err := Dial(context.Background(), filepath.Join(t.TempDir(), "missing.sock"))
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Dial error = %v, want ErrUnavailable", err)
+	}
+}
@@ -0,0 +1,67 @@
+package protocol
+
+// Error codes, sent in the code field of a failed response. The error field
+// keeps the message older clients display.
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeRequestTooLarge     = "request_too_large"
+	CodeUnknownOp           = "unknown_op"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeBoardNotFound       = "board_not_found"
+	CodeBoardExists         = "board_exists"
+	CodeInvalidBoardName    = "invalid_board_name"
+	CodeDefaultBoard        = "default_board"
+	CodeInvalidContent      = "invalid_content"
+	CodeTooLarge            = "too_large"
+	CodeInvalidQuery        = "invalid_query"
+	CodeClipboard           = "clipboard_error"
+	CodeUnknownTransform    = "unknown_transform"
+	CodeTransformFailed     = "transform_failed"
+	CodeUnknownMode         = "unknown_mode"
+	CodeEmptyResult         = "empty_result"
+	CodeMissingField        = "missing_field"
+	CodeExpandFailed        = "expand_failed"
+	CodeSnippetsUnavailable = "snippets_unavailable"
+	CodeDumpFailed          = "dump_failed"
+)
+
+var messages = map[string]string{
+	CodeInvalidRequest:      "invalid json",
+	CodeRequestTooLarge:     "request too large",
+	CodeUnknownOp:           "unknown op",
+	CodeForbidden:           "forbidden",
+	CodeNotFound:            "not found",
+	CodeBoardNotFound:       "board not found",
+	CodeBoardExists:         "board exists",
+	CodeInvalidBoardName:    "invalid board name",
+	CodeDefaultBoard:        "cannot delete default board",
+	CodeInvalidContent:      "invalid content",
+	CodeTooLarge:            "too large",
+	CodeInvalidQuery:        "invalid query",
+	CodeClipboard:           "clipboard error",
+	CodeUnknownTransform:    "unknown transform",
+	CodeTransformFailed:     "transform failed",
+	CodeUnknownMode:         "unknown mode",
+	CodeEmptyResult:         "empty result",
+	CodeMissingField:        "missing field",
+	CodeExpandFailed:        "expand failed",
+	CodeSnippetsUnavailable: "snippets unavailable",
+	CodeDumpFailed:          "dump failed",
+}
+
+// Message returns the error message sent with code.
+func Message(code string) string {
+	return messages[code]
+}
+
+// ErrorCode returns the code for an error message, for responses from
+// daemons that predate error codes. Unknown messages give "".
+func ErrorCode(message string) string {
+	for code, text := range messages {
+		if text == message {
+			return code
+		}
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// PageBytes is roughly how much entry content one page of a paged response
+// carries. A page always holds at least one entry.
+const PageBytes = 256 << 10
+
+// ErrLineTooLong is returned by ReadLine for a line over the limit. The
+// line has been consumed, so the next one can still be read.
+var ErrLineTooLong = errors.New("line too long")
+
+// LineLimit is the longest request or response line for entries of up to
+// maxBytes: JSON may escape a byte as six, and the other fields need some
+// room. A page of a paged response holds either a single entry or at most
+// PageBytes of content and per-entry overhead, so it fits the same limit.
+func LineLimit(maxBytes int) int {
+	if maxBytes < PageBytes {
+		maxBytes = PageBytes
+	}
+	return 6*maxBytes + 64<<10
+}
+
+// ReadLine reads one newline-terminated line of at most limit bytes. A
+// final line without a newline is returned as is.
+func ReadLine(r *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > limit {
+			for errors.Is(err, bufio.ErrBufferFull) {
+				_, err = r.ReadSlice('\n')
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			return nil, ErrLineTooLong
+		}
+		line = append(line, chunk...)
+		switch {
+		case err == nil:
+			return line, nil
+		case errors.Is(err, io.EOF) && len(line) > 0:
+			return line, nil
+		case !errors.Is(err, bufio.ErrBufferFull):
+			return nil, err
+		}
+	}
+}
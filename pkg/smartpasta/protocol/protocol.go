@@ -0,0 +1,142 @@
+// Package protocol defines the messages smartpasta-daemon exchanges with
+// its clients over the IPC socket. It has no dependencies beyond the
+// standard library, so the daemon and pkg/smartpasta can share it.
+package protocol
+
+import "time"
+
+// Version is raised when a change would break existing clients. Additions
+// are announced through Hello.Ops and Hello.Capabilities instead.
+const Version = 1
+
+const (
+	DefaultBoard = "default"
+	// DefaultMaxBytes is the daemon's entry size limit unless configured
+	// otherwise.
+	DefaultMaxBytes = 1 << 20
+)
+
+const (
+	SearchSubstring       = "substring"
+	SearchCaseInsensitive = "icase"
+	SearchFuzzy           = "fuzzy"
+	SearchRegex           = "regex"
+)
+
+const (
+	TransformModeReplace = "replace"
+	TransformModeAdd     = "add"
+)
+
+const (
+	ChangeAdded    = "added"
+	ChangeSelected = "selected"
+	ChangeUpdated  = "updated"
+	ChangeDeleted  = "deleted"
+	ChangeCleared  = "cleared"
+	// ChangeBoardDeleted is sent once when a board is deleted; its
+	// subscribers get no further events.
+	ChangeBoardDeleted = "board_deleted"
+)
+
+type Entry struct {
+	ID        int64             `json:"id"`
+	Content   string            `json:"content"`
+	CreatedAt time.Time         `json:"created_at"`
+	Kind      string            `json:"kind,omitempty"`
+	Meta      map[string]string `json:"meta,omitempty"`
+	EditedAt  *time.Time        `json:"edited_at,omitempty"`
+	Source    string            `json:"source,omitempty"`
+	Pinned    bool              `json:"pinned,omitempty"`
+	// Sensitive entries (e.g. passwords) are masked in the picker and left
+	// out of searches and dumps.
+	Sensitive bool `json:"sensitive,omitempty"`
+}
+
+type Query struct {
+	Text   string
+	Mode   string
+	Limit  int
+	Offset int
+}
+
+// Match is a ranked search result. Positions are byte offsets of the
+// matched characters in the entry content.
+type Match struct {
+	Entry     Entry `json:"entry"`
+	Score     int   `json:"score"`
+	Positions []int `json:"positions,omitempty"`
+}
+
+type BoardInfo struct {
+	Name    string `json:"name"`
+	Active  bool   `json:"active"`
+	Entries int    `json:"entries"`
+}
+
+// Change describes one modification of a board. Added, selected and updated
+// changes carry the entry; deleted carries its ID. Cleared means every
+// unpinned entry was removed, board deleted that the board itself was.
+type Change struct {
+	Type  string `json:"event"`
+	Board string `json:"board"`
+	Entry *Entry `json:"entry,omitempty"`
+	ID    int64  `json:"id,omitempty"`
+}
+
+type Snippet struct {
+	Name    string   `json:"name"`
+	Content string   `json:"content"`
+	Fields  []string `json:"fields,omitempty"`
+}
+
+// Hello describes the daemon, answering the hello op.
+type Hello struct {
+	Protocol     int      `json:"protocol"`
+	Version      string   `json:"version"`
+	Flavor       string   `json:"flavor,omitempty"`
+	MaxBytes     int      `json:"max_bytes"`
+	Ops          []string `json:"ops"`
+	Capabilities []string `json:"capabilities"`
+}
+
+type Request struct {
+	Op        string            `json:"op"`
+	ID        int64             `json:"id,omitempty"`
+	Content   string            `json:"content,omitempty"`
+	Transform string            `json:"transform,omitempty"`
+	Mode      string            `json:"mode,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Board     string            `json:"board,omitempty"`
+	To        string            `json:"to,omitempty"`
+	Query     string            `json:"query,omitempty"`
+	Limit     int               `json:"limit,omitempty"`
+	Offset    int               `json:"offset,omitempty"`
+	Source    string            `json:"source,omitempty"`
+	Clipboard bool              `json:"clipboard,omitempty"`
+	Pinned    bool              `json:"pinned,omitempty"`
+	Sensitive bool              `json:"sensitive,omitempty"`
+	// Paged asks for entries and matches to be sent in several response
+	// lines; see Response.More.
+	Paged bool `json:"paged,omitempty"`
+	// ReqID is echoed in the response so a client can match pipelined
+	// requests to their responses.
+	ReqID uint64 `json:"req_id,omitempty"`
+}
+
+type Response struct {
+	Ok       bool        `json:"ok"`
+	ReqID    uint64      `json:"req_id,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Code     string      `json:"code,omitempty"`
+	Hello    *Hello      `json:"hello,omitempty"`
+	Entries  []Entry     `json:"entries,omitempty"`
+	Content  string      `json:"content,omitempty"`
+	Snippets []Snippet   `json:"snippets,omitempty"`
+	Boards   []BoardInfo `json:"boards,omitempty"`
+	Matches  []Match     `json:"matches,omitempty"`
+	Total    int         `json:"total,omitempty"`
+	// More is set on every page of a paged response but the last.
+	More bool `json:"more,omitempty"`
+}
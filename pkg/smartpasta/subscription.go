@@ -0,0 +1,83 @@
+package smartpasta
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/triiberg/smartpasta/pkg/smartpasta/protocol"
+)
+
+// ErrClosed is returned by Subscription.Next once the subscription has been
+// closed or the daemon ended the stream.
+var ErrClosed = errors.New("subscription closed")
+
+// Subscription is a stream of history changes on its own connection.
+type Subscription struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	lineLimit int
+	err       error
+}
+
+// Subscribe opens a second connection that streams the changes to board,
+// or to all boards when board is empty.
+func (c *Client) Subscribe(ctx context.Context, board string) (*Subscription, error) {
+	stream := &Client{socketPath: c.socketPath, Board: board, Timeout: c.Timeout, lineLimit: c.lineLimit}
+	if _, err := stream.Do(ctx, Request{Op: "subscribe"}); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	// The stream is read without a deadline from here on.
+	_ = stream.conn.SetDeadline(time.Time{})
+	return &Subscription{conn: stream.conn, reader: stream.reader, lineLimit: stream.lineLimit}, nil
+}
+
+// Next waits for the next change. Once it returns an error the
+// subscription is finished and every later call returns the same error;
+// subscribe again to resume.
+func (s *Subscription) Next(ctx context.Context) (Change, error) {
+	var change Change
+	if s.err != nil {
+		return change, s.err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = s.conn.SetReadDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	for {
+		line, err := protocol.ReadLine(s.reader, s.lineLimit)
+		if errors.Is(err, protocol.ErrLineTooLong) {
+			// The oversized event was skipped whole; the stream is intact.
+			continue
+		}
+		if err != nil {
+			s.finish(ctx.Err())
+			return change, s.err
+		}
+		if err := json.Unmarshal(line, &change); err == nil {
+			return change, nil
+		}
+	}
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() error {
+	if s.err != nil {
+		return nil
+	}
+	s.finish(nil)
+	return nil
+}
+
+func (s *Subscription) finish(err error) {
+	if err == nil {
+		err = ErrClosed
+	}
+	s.err = err
+	_ = s.conn.Close()
+}
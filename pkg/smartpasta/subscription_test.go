@@ -0,0 +1,111 @@
+package smartpasta
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionNext(t *testing.T) {
+	ctx := context.Background()
+	c, _ := startDaemon(t, 0)
+
+	sub, err := c.Subscribe(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	entry, err := c.Add(ctx, "hello", AddOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, entry.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := sub.Next(ctx)
+	if err != nil || change.Type != ChangeAdded || change.Entry == nil || change.Entry.ID != entry.ID {
+		t.Fatalf("first Next = %+v, %v", change, err)
+	}
+	change, err = sub.Next(ctx)
+	if err != nil || change.Type != ChangeDeleted || change.ID != entry.ID || change.Board != DefaultBoard {
+		t.Fatalf("second Next = %+v, %v", change, err)
+	}
+
+	// A Next that runs out of time ends the subscription for good.
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := sub.Next(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Next without changes = %v, want deadline exceeded", err)
+	}
+	if _, err := c.Add(ctx, "later", AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sub.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Next after the deadline = %v, want the same error", err)
+	}
+}
+
+func TestSubscriptionBoardAndClose(t *testing.T) {
+	ctx := context.Background()
+	c, _ := startDaemon(t, 0)
+	if err := c.CreateBoard(ctx, "work"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Subscribe(ctx, "missing"); !IsCode(err, CodeBoardNotFound) {
+		t.Fatalf("Subscribe to a missing board = %v", err)
+	}
+
+	sub, err := c.Subscribe(ctx, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Add(ctx, "on default", AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	c.Board = "work"
+	if _, err := c.Add(ctx, "on work", AddOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	change, err := sub.Next(ctx)
+	if err != nil || change.Board != "work" || change.Entry.Content != "on work" {
+		t.Fatalf("Next = %+v, %v; want only work's changes", change, err)
+	}
+
+	if err := sub.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sub.Next(ctx); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Next after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestSubscriptionBoardDeleted(t *testing.T) {
+	ctx := context.Background()
+	c, _ := startDaemon(t, 0)
+	if err := c.CreateBoard(ctx, "work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SwitchBoard(ctx, "work"); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := c.Subscribe(ctx, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if err := c.DeleteBoard(ctx, "work"); err != nil {
+		t.Fatal(err)
+	}
+	change, err := sub.Next(ctx)
+	if err != nil || change.Type != ChangeBoardDeleted || change.Board != "work" {
+		t.Fatalf("Next = %+v, %v; want work deleted", change, err)
+	}
+	boards, err := c.Boards(ctx)
+	if err != nil || len(boards) != 1 || !boards[0].Active {
+		t.Fatalf("Boards = %+v, %v; want only the default board, active", boards, err)
+	}
+}